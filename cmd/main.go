@@ -13,12 +13,12 @@ import (
 	"loadbalancer/internal/server"
 )
 
-func extractPortsFromBackends(backends []string) ([]int, error) {
+func extractPortsFromBackends(backends []config.BackendConfig) ([]int, error) {
 	var ports []int
 	for _, backend := range backends {
-		parsedURL, err := url.Parse(backend)
+		parsedURL, err := url.Parse(backend.URL)
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse backend URL %s: %w", backend, err)
+			return nil, fmt.Errorf("failed to parse backend URL %s: %w", backend.URL, err)
 		}
 
 		port := 80 // по умолчанию
@@ -63,7 +63,10 @@ func main() {
 	startTestServers(ports)
 
 	// Создание и запуск сервера балансировщика
-	lbServer := server.NewLoadBalancerServer(cfg)
+	lbServer, err := server.NewLoadBalancerServer(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create load balancer server: %v", err)
+	}
 	if err := lbServer.Start(); err != nil {
 		log.Fatalf("Failed to start load balancer server: %v", err)
 	}
@@ -0,0 +1,73 @@
+package accesslog
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// combinedHandler пишет записи в формате Apache combined. Поля, которых нет
+// в этом формате (request_id, backend и т. д.), дописываются в конец строки
+// в виде key=value.
+type combinedHandler struct {
+	w  io.Writer
+	mu *sync.Mutex
+}
+
+func newCombinedHandler(w io.Writer) *combinedHandler {
+	return &combinedHandler{w: w, mu: &sync.Mutex{}}
+}
+
+func (h *combinedHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *combinedHandler) WithAttrs([]slog.Attr) slog.Handler {
+	return h
+}
+
+func (h *combinedHandler) WithGroup(string) slog.Handler {
+	return h
+}
+
+func (h *combinedHandler) Handle(_ context.Context, record slog.Record) error {
+	fields := make(map[string]slog.Value)
+	record.Attrs(func(a slog.Attr) bool {
+		fields[a.Key] = a.Value
+		return true
+	})
+	str := func(key string) string {
+		if v, ok := fields[key]; ok && v.String() != "" {
+			return v.String()
+		}
+		return "-"
+	}
+
+	// Адрес клиента с учетом доверенных прокси
+	host := str("client_ip")
+	user := str("client_id")
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s - %s [%s] \"%s %s %s\" %s %s \"%s\" \"%s\"",
+		host, user, record.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		str("method"), str("uri"), str("proto"),
+		str("status"), str("bytes"), str("referer"), str("user_agent"))
+
+	for _, key := range []string{"request_id", "ratelimit", "backend", "retries"} {
+		fmt.Fprintf(&sb, " %s=%s", key, str(key))
+	}
+	for _, key := range []string{"duration", "upstream_duration"} {
+		ms := float64(fields[key].Duration()) / float64(time.Millisecond)
+		fmt.Fprintf(&sb, " %s_ms=%.3f", key, ms)
+	}
+	sb.WriteByte('\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, sb.String())
+	return err
+}
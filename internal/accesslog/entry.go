@@ -0,0 +1,35 @@
+package accesslog
+
+import (
+	"context"
+	"time"
+)
+
+type contextKey struct{}
+
+// Entry собирает сведения о запросе по мере его обработки: обработчик
+// rate-limit-а заполняет клиента и решение, балансировщик — бэкенд и повторы
+type Entry struct {
+	RequestID        string
+	ClientID         string
+	RateLimit        string // allowed, denied, quota_exceeded или concurrency_limited
+	Cost             int    // стоимость запроса в токенах rate-limit-а
+	Backend          string
+	Retries          int
+	UpstreamDuration time.Duration
+}
+
+// WithEntry возвращает контекст с записью журнала доступа
+func WithEntry(ctx context.Context, entry *Entry) context.Context {
+	return context.WithValue(ctx, contextKey{}, entry)
+}
+
+// FromContext возвращает запись журнала доступа запроса. Если журнал
+// выключен, возвращается пустая запись, чтобы вызывающему не нужно было
+// проверять nil.
+func FromContext(ctx context.Context) *Entry {
+	if entry, ok := ctx.Value(contextKey{}).(*Entry); ok {
+		return entry
+	}
+	return &Entry{}
+}
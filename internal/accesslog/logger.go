@@ -0,0 +1,50 @@
+package accesslog
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+const (
+	FormatJSON     = "json"
+	FormatLogfmt   = "logfmt"
+	FormatCombined = "combined"
+)
+
+// NewLogger создает логгер журнала доступа в формате json, logfmt или
+// combined (Apache), пишущий в w
+func NewLogger(format string, w io.Writer) (*slog.Logger, error) {
+	switch format {
+	case "", FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, nil)), nil
+	case FormatLogfmt:
+		return slog.New(slog.NewTextHandler(w, nil)), nil
+	case FormatCombined:
+		return slog.New(newCombinedHandler(w)), nil
+	default:
+		return nil, fmt.Errorf("unknown access log format %q", format)
+	}
+}
+
+// NewOutput открывает вывод журнала: "stdout" (по умолчанию) или путь к файлу,
+// который ротируется по достижении maxSize байт
+func NewOutput(output string, maxSize int64, maxBackups int) (io.WriteCloser, error) {
+	switch output {
+	case "", "stdout":
+		return nopCloser{os.Stdout}, nil
+	case "stderr":
+		return nopCloser{os.Stderr}, nil
+	default:
+		return NewRotatingFile(output, maxSize, maxBackups)
+	}
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
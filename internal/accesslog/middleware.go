@@ -0,0 +1,90 @@
+package accesslog
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+
+	util "loadbalancer/pkg/httputil"
+)
+
+// RequestIDHeader — заголовок с идентификатором запроса. Если клиент его не
+// прислал, идентификатор генерируется и передается бэкенду и клиенту.
+const RequestIDHeader = "X-Request-ID"
+
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap нужен http.ResponseController, через который ReverseProxy сбрасывает буфер
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Middleware пишет в logger запись о каждом запросе после его обработки
+func Middleware(logger *slog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		entry := &Entry{RequestID: r.Header.Get(RequestIDHeader)}
+		if entry.RequestID == "" {
+			entry.RequestID = newRequestID()
+			r.Header.Set(RequestIDHeader, entry.RequestID)
+		}
+		w.Header().Set(RequestIDHeader, entry.RequestID)
+
+		rw := &responseWriter{ResponseWriter: w}
+		next.ServeHTTP(rw, r.WithContext(WithEntry(r.Context(), entry)))
+
+		status := rw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		logger.LogAttrs(r.Context(), slog.LevelInfo, "request",
+			slog.String("request_id", entry.RequestID),
+			slog.String("remote_addr", r.RemoteAddr),
+			slog.String("client_ip", util.ClientIP(r)),
+			slog.String("client_id", entry.ClientID),
+			slog.String("method", r.Method),
+			slog.String("uri", r.RequestURI),
+			slog.String("proto", r.Proto),
+			slog.Int("status", status),
+			slog.Int64("bytes", rw.bytes),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("referer", r.Referer()),
+			slog.String("user_agent", r.UserAgent()),
+			slog.String("ratelimit", entry.RateLimit),
+			slog.Int("ratelimit_cost", entry.Cost),
+			slog.String("backend", entry.Backend),
+			slog.Int("retries", entry.Retries),
+			slog.Duration("upstream_duration", entry.UpstreamDuration),
+		)
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
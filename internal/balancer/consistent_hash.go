@@ -0,0 +1,96 @@
+package balancer
+
+import (
+	"hash/fnv"
+	"slices"
+	"sort"
+	"strconv"
+
+	"loadbalancer/internal/domain"
+)
+
+// ReplicasPerWeight — число виртуальных узлов на единицу веса сервера
+const ReplicasPerWeight = 100
+
+type ringPoint struct {
+	hash   uint64
+	server *domain.Server
+}
+
+// ringMember — сервер кольца и вес, с которым он был добавлен
+type ringMember struct {
+	server *domain.Server
+	weight int
+}
+
+// ConsistentHash распределяет запросы по кольцу consistent hashing: запрос с
+// одним и тем же ключом попадает на один и тот же сервер, а добавление сервера
+// перемещает примерно 1/N ключей. Недоступный сервер пропускается переходом к
+// следующей точке кольца, остальные ключи при этом не перераспределяются.
+type ConsistentHash struct {
+	ring    []ringPoint
+	members []ringMember
+}
+
+func NewConsistentHash() *ConsistentHash {
+	return &ConsistentHash{}
+}
+
+func (s *ConsistentHash) Next(servers []*domain.Server, sel Selection) (*domain.Server, error) {
+	s.rebuild(servers)
+	if len(s.ring) == 0 {
+		return nil, ErrNoHealthyServers
+	}
+
+	h := hashKey(sel.Key)
+	start := sort.Search(len(s.ring), func(i int) bool { return s.ring[i].hash >= h })
+
+	for i := 0; i < len(s.ring); i++ {
+		point := s.ring[(start+i)%len(s.ring)]
+		if sel.eligible(point.server) {
+			return point.server, nil
+		}
+	}
+	return nil, ErrNoHealthyServers
+}
+
+// rebuild перестраивает кольцо, только если изменился набор серверов или их
+// веса. Серверы сравниваются по указателям: сервер, удаленный и добавленный
+// заново с тем же URL, — новый объект, и кольцо не должно ссылаться на старый.
+func (s *ConsistentHash) rebuild(servers []*domain.Server) {
+	members := make([]ringMember, len(servers))
+	for i, server := range servers {
+		members[i] = ringMember{server: server, weight: server.Weight}
+	}
+	if s.ring != nil && slices.Equal(members, s.members) {
+		return
+	}
+
+	ring := make([]ringPoint, 0, len(servers)*ReplicasPerWeight)
+	for _, server := range servers {
+		for i := 0; i < server.Weight*ReplicasPerWeight; i++ {
+			ring = append(ring, ringPoint{
+				hash:   hashKey(server.URL.String() + "#" + strconv.Itoa(i)),
+				server: server,
+			})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+
+	s.ring = ring
+	s.members = members
+}
+
+// hashKey — FNV-1a с финализатором из MurmurHash3: у FNV плохо перемешаны
+// старшие биты для похожих строк ("url#1", "url#2"), и точки кольца слипаются.
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
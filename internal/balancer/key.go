@@ -0,0 +1,57 @@
+package balancer
+
+import (
+	"fmt"
+	"net/http"
+
+	util "loadbalancer/pkg/httputil"
+)
+
+const (
+	KeySourceIP     = "ip"
+	KeySourceHeader = "header"
+	KeySourceCookie = "cookie"
+	KeySourcePath   = "path"
+)
+
+// KeyFunc извлекает из запроса ключ для consistent hashing
+type KeyFunc func(r *http.Request) string
+
+// NewKeyFunc создает KeyFunc по источнику из config.json. Если в запросе нет
+// нужного заголовка или cookie, ключом служит IP клиента.
+func NewKeyFunc(source, name string) (KeyFunc, error) {
+	switch source {
+	case "", KeySourceIP:
+		return clientIP, nil
+	case KeySourceHeader:
+		if name == "" {
+			return nil, fmt.Errorf("hash key source %q requires a name", source)
+		}
+		return func(r *http.Request) string {
+			if v := r.Header.Get(name); v != "" {
+				return v
+			}
+			return clientIP(r)
+		}, nil
+	case KeySourceCookie:
+		if name == "" {
+			return nil, fmt.Errorf("hash key source %q requires a name", source)
+		}
+		return func(r *http.Request) string {
+			if c, err := r.Cookie(name); err == nil && c.Value != "" {
+				return c.Value
+			}
+			return clientIP(r)
+		}, nil
+	case KeySourcePath:
+		return func(r *http.Request) string {
+			return r.URL.Path
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown hash key source %q", source)
+	}
+}
+
+func clientIP(r *http.Request) string {
+	return util.ClientIP(r)
+}
@@ -0,0 +1,47 @@
+package balancer
+
+import (
+	"sync/atomic"
+
+	"loadbalancer/internal/domain"
+)
+
+// LeastConnections выбирает здоровый сервер с наименьшим числом активных
+// запросов относительно его веса. При равенстве серверы перебираются по кругу,
+// чтобы на холодном старте нагрузка не уходила целиком на первый бэкенд.
+type LeastConnections struct {
+	offset int
+}
+
+func NewLeastConnections() *LeastConnections {
+	return &LeastConnections{}
+}
+
+func (s *LeastConnections) Next(servers []*domain.Server, sel Selection) (*domain.Server, error) {
+	var best *domain.Server
+	var bestActive int64
+
+	n := len(servers)
+	for i := 0; i < n; i++ {
+		server := servers[(s.offset+i)%n]
+		if !sel.eligible(server) {
+			continue
+		}
+
+		active := atomic.LoadInt64(&server.ActiveRequests)
+		// Сравниваем active/weight без деления: a1*w2 < a2*w1
+		if best == nil || active*int64(best.Weight) < bestActive*int64(server.Weight) {
+			best = server
+			bestActive = active
+		}
+	}
+
+	if best == nil {
+		return nil, ErrNoHealthyServers
+	}
+
+	if n > 0 {
+		s.offset = (s.offset + 1) % n
+	}
+	return best, nil
+}
@@ -0,0 +1,84 @@
+package balancer
+
+import (
+	"math"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"loadbalancer/internal/domain"
+)
+
+// LatencyDecay — постоянная времени затухания EWMA. Чем она больше, тем дольше
+// помнится медленный ответ бэкенда.
+const LatencyDecay = 10 * time.Second
+
+// ObserveLatency обновляет peak-EWMA задержки сервера: рост задержки
+// учитывается сразу (peak), снижение — плавно, с весом, зависящим от времени
+// с прошлого наблюдения. Вызывается под блокировкой репозитория.
+func ObserveLatency(server *domain.Server, rtt time.Duration, now time.Time) {
+	sample := float64(rtt)
+	if server.LatencyUpdated.IsZero() || sample > server.LatencyEWMA {
+		server.LatencyEWMA = sample
+	} else {
+		w := math.Exp(-float64(now.Sub(server.LatencyUpdated)) / float64(LatencyDecay))
+		server.LatencyEWMA = server.LatencyEWMA*w + sample*(1-w)
+	}
+	server.LatencyUpdated = now
+}
+
+// LatencyScore возвращает стоимость отправки запроса на сервер: затухающая
+// EWMA задержки, умноженная на число активных запросов и деленная на вес.
+// Без новых наблюдений задержка затухает, и восстановившийся бэкенд снова
+// получает трафик.
+func LatencyScore(server *domain.Server, now time.Time) float64 {
+	latency := server.LatencyEWMA
+	if !server.LatencyUpdated.IsZero() {
+		latency *= math.Exp(-float64(now.Sub(server.LatencyUpdated)) / float64(LatencyDecay))
+	}
+	active := float64(atomic.LoadInt64(&server.ActiveRequests) + 1)
+	return latency * active / float64(server.Weight)
+}
+
+// PeakEWMA выбирает сервер методом power of two choices: берет два случайных
+// здоровых сервера и отдает запрос тому, у кого меньше LatencyScore.
+type PeakEWMA struct {
+	rnd *rand.Rand
+	now func() time.Time
+}
+
+func NewPeakEWMA() *PeakEWMA {
+	return &PeakEWMA{
+		rnd: rand.New(rand.NewSource(time.Now().UnixNano())),
+		now: time.Now,
+	}
+}
+
+func (s *PeakEWMA) Next(servers []*domain.Server, sel Selection) (*domain.Server, error) {
+	healthy := make([]*domain.Server, 0, len(servers))
+	for _, server := range servers {
+		if sel.eligible(server) {
+			healthy = append(healthy, server)
+		}
+	}
+
+	switch len(healthy) {
+	case 0:
+		return nil, ErrNoHealthyServers
+	case 1:
+		return healthy[0], nil
+	}
+
+	i := s.rnd.Intn(len(healthy))
+	j := s.rnd.Intn(len(healthy) - 1)
+	if j >= i {
+		j++
+	}
+
+	now := s.now()
+	a, b := healthy[i], healthy[j]
+	if LatencyScore(b, now) < LatencyScore(a, now) {
+		return b, nil
+	}
+	return a, nil
+}
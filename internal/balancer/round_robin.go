@@ -0,0 +1,35 @@
+package balancer
+
+import "loadbalancer/internal/domain"
+
+// RoundRobin реализует smooth weighted round-robin (как в nginx):
+// каждый здоровый сервер увеличивает текущий вес на свой вес, выбирается сервер
+// с максимальным текущим весом, и его текущий вес уменьшается на сумму весов.
+type RoundRobin struct{}
+
+func NewRoundRobin() *RoundRobin {
+	return &RoundRobin{}
+}
+
+func (s *RoundRobin) Next(servers []*domain.Server, sel Selection) (*domain.Server, error) {
+	var best *domain.Server
+	total := 0
+	for _, server := range servers {
+		if !sel.eligible(server) {
+			continue
+		}
+		server.CurrentWeight += server.Weight
+		total += server.Weight
+		if best == nil || server.CurrentWeight > best.CurrentWeight {
+			best = server
+		}
+	}
+
+	// Прошли все серверы и не нашли здоровый
+	if best == nil {
+		return nil, ErrNoHealthyServers
+	}
+
+	best.CurrentWeight -= total
+	return best, nil
+}
@@ -0,0 +1,78 @@
+package balancer
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// StickySessions привязывает клиента к бэкенду через подписанную cookie.
+// Значение cookie — URL бэкенда и HMAC-SHA256 от него, поэтому клиент не может
+// сам выбрать произвольный бэкенд.
+type StickySessions struct {
+	cookieName string
+	secret     []byte
+	maxAge     time.Duration
+}
+
+// NewStickySessions создает привязку сессий. Если secret пустой, генерируется
+// случайный ключ: cookie перестанут приниматься после перезапуска.
+func NewStickySessions(cookieName, secret string, maxAge time.Duration) (*StickySessions, error) {
+	key := []byte(secret)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+	return &StickySessions{
+		cookieName: cookieName,
+		secret:     key,
+		maxAge:     maxAge,
+	}, nil
+}
+
+// Backend возвращает URL бэкенда из cookie запроса, если подпись верна
+func (s *StickySessions) Backend(r *http.Request) (string, bool) {
+	c, err := r.Cookie(s.cookieName)
+	if err != nil {
+		return "", false
+	}
+
+	encoded, signature, ok := strings.Cut(c.Value, ".")
+	if !ok {
+		return "", false
+	}
+	rawurl, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", false
+	}
+	expected := s.sign(rawurl)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return "", false
+	}
+	return string(rawurl), true
+}
+
+// Cookie возвращает cookie, закрепляющую клиента за бэкендом
+func (s *StickySessions) Cookie(backendURL string) *http.Cookie {
+	value := []byte(backendURL)
+	return &http.Cookie{
+		Name:     s.cookieName,
+		Value:    base64.RawURLEncoding.EncodeToString(value) + "." + s.sign(value),
+		Path:     "/",
+		MaxAge:   int(s.maxAge / time.Second),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func (s *StickySessions) sign(value []byte) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write(value)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
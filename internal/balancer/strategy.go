@@ -0,0 +1,53 @@
+package balancer
+
+import (
+	"errors"
+	"fmt"
+
+	"loadbalancer/internal/domain"
+)
+
+const (
+	StrategyRoundRobin       = "round_robin"
+	StrategyLeastConnections = "least_connections"
+	StrategyPeakEWMA         = "peak_ewma"
+	StrategyConsistentHash   = "consistent_hash"
+)
+
+var ErrNoHealthyServers = errors.New("no healthy servers available")
+
+// Selection — параметры выбора сервера для запроса
+type Selection struct {
+	// Key — ключ запроса (см. KeyFunc), его учитывают только стратегии с
+	// привязкой запросов к серверу
+	Key string
+	// Exclude — URL серверов, на которые запрос уже неудачно отправлялся
+	Exclude map[string]bool
+}
+
+// eligible сообщает, можно ли выбрать сервер для запроса
+func (sel Selection) eligible(server *domain.Server) bool {
+	return server.Available() && !sel.Exclude[server.URL.String()]
+}
+
+// Strategy выбирает сервер из списка. Вызывается под блокировкой репозитория,
+// поэтому реализациям не нужна собственная синхронизация.
+type Strategy interface {
+	Next(servers []*domain.Server, sel Selection) (*domain.Server, error)
+}
+
+// New создает стратегию по имени из config.json. Пустое имя — round-robin.
+func New(name string) (Strategy, error) {
+	switch name {
+	case "", StrategyRoundRobin:
+		return NewRoundRobin(), nil
+	case StrategyLeastConnections:
+		return NewLeastConnections(), nil
+	case StrategyPeakEWMA:
+		return NewPeakEWMA(), nil
+	case StrategyConsistentHash:
+		return NewConsistentHash(), nil
+	default:
+		return nil, fmt.Errorf("unknown balancing strategy %q", name)
+	}
+}
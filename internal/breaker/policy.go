@@ -0,0 +1,169 @@
+package breaker
+
+import (
+	"time"
+
+	"loadbalancer/internal/domain"
+)
+
+// HistorySize — сколько последних переходов состояния хранится для сервера
+const HistorySize = 20
+
+// Outcome — результат проксированного запроса для circuit breaker
+type Outcome int
+
+const (
+	Success Outcome = iota
+	Failure
+	// Ignored — запрос не характеризует бэкенд (например, клиент разорвал
+	// соединение); пробный слот half-open при этом освобождается
+	Ignored
+)
+
+// Policy реализует circuit breaker для каждого сервера. В состоянии closed
+// результаты запросов собираются в скользящее окно Window из Buckets корзин;
+// если за окно было не меньше MinRequests запросов и доля ошибок достигла
+// FailureRatio, цепь размыкается (open) и сервер не получает запросов
+// OpenTimeout. Затем цепь переходит в half-open и пропускает не более
+// HalfOpenRequests пробных запросов одновременно: столько же успешных подряд
+// замыкают цепь, любая ошибка снова размыкает ее.
+//
+// Методы вызываются под блокировкой репозитория.
+type Policy struct {
+	Enabled          bool
+	Window           time.Duration
+	Buckets          int
+	MinRequests      int
+	FailureRatio     float64
+	OpenTimeout      time.Duration
+	HalfOpenRequests int
+}
+
+// Refresh переводит цепь из open в half-open по истечении OpenTimeout
+func (p Policy) Refresh(server *domain.Server, now time.Time, onChange func(domain.CircuitEvent)) {
+	c := &server.Circuit
+	if c.State == domain.CircuitOpen && now.Sub(c.OpenedAt) >= p.OpenTimeout {
+		p.transition(c, domain.CircuitHalfOpen, "open timeout elapsed", now, onChange)
+	}
+}
+
+// OnSelect учитывает, что сервер выбран для запроса, и возвращает поколение
+// цепи, которое нужно передать в Record вместе с результатом
+func (p Policy) OnSelect(server *domain.Server) uint64 {
+	c := &server.Circuit
+	if c.State == domain.CircuitHalfOpen {
+		c.TrialsInFlight++
+		p.updateBlocked(c)
+	}
+	return c.Generation
+}
+
+// Record учитывает результат запроса к серверу. Результаты запросов,
+// выбранных до последнего перехода цепи, отбрасываются: они не должны
+// занимать пробные слоты half-open и влиять на новое состояние.
+func (p Policy) Record(server *domain.Server, generation uint64, outcome Outcome, reason string, now time.Time, onChange func(domain.CircuitEvent)) {
+	if !p.Enabled {
+		return
+	}
+	c := &server.Circuit
+	if generation != c.Generation {
+		return
+	}
+
+	switch c.State {
+	case domain.CircuitHalfOpen:
+		if c.TrialsInFlight > 0 {
+			c.TrialsInFlight--
+		}
+		switch outcome {
+		case Failure:
+			p.transition(c, domain.CircuitOpen, reason, now, onChange)
+		case Success:
+			c.TrialSuccesses++
+			if c.TrialSuccesses >= p.halfOpenRequests() {
+				p.transition(c, domain.CircuitClosed, "trial requests succeeded", now, onChange)
+			}
+		}
+		p.updateBlocked(c)
+
+	case domain.CircuitClosed, "":
+		if outcome == Ignored {
+			return
+		}
+		bucket := p.bucket(c, now)
+		bucket.Requests++
+		if outcome == Failure {
+			bucket.Failures++
+		}
+
+		requests, failures := 0, 0
+		for _, b := range c.Window {
+			requests += b.Requests
+			failures += b.Failures
+		}
+		if requests >= p.MinRequests && float64(failures) >= p.FailureRatio*float64(requests) && failures > 0 {
+			p.transition(c, domain.CircuitOpen, reason, now, onChange)
+		}
+	}
+}
+
+// bucket возвращает текущую корзину окна, отбрасывая устаревшие
+func (p Policy) bucket(c *domain.Circuit, now time.Time) *domain.CircuitBucket {
+	size := p.Window / time.Duration(max(p.Buckets, 1))
+	start := now.Truncate(size)
+
+	keep := 0
+	for _, b := range c.Window {
+		if now.Sub(b.Start) < p.Window {
+			c.Window[keep] = b
+			keep++
+		}
+	}
+	c.Window = c.Window[:keep]
+
+	if n := len(c.Window); n > 0 && c.Window[n-1].Start.Equal(start) {
+		return &c.Window[n-1]
+	}
+	c.Window = append(c.Window, domain.CircuitBucket{Start: start})
+	return &c.Window[len(c.Window)-1]
+}
+
+func (p Policy) transition(c *domain.Circuit, to, reason string, now time.Time, onChange func(domain.CircuitEvent)) {
+	event := domain.CircuitEvent{From: c.State, To: to, Reason: reason, At: now}
+	if event.From == "" {
+		event.From = domain.CircuitClosed
+	}
+
+	c.State = to
+	c.Generation++
+	c.Window = nil
+	c.TrialsInFlight = 0
+	c.TrialSuccesses = 0
+	if to == domain.CircuitOpen {
+		c.OpenedAt = now
+	}
+	p.updateBlocked(c)
+
+	c.History = append(c.History, event)
+	if len(c.History) > HistorySize {
+		c.History = c.History[len(c.History)-HistorySize:]
+	}
+	if onChange != nil {
+		onChange(event)
+	}
+}
+
+func (p Policy) updateBlocked(c *domain.Circuit) {
+	switch c.State {
+	case domain.CircuitOpen:
+		c.Blocked = true
+	case domain.CircuitHalfOpen:
+		c.Blocked = c.TrialsInFlight >= p.halfOpenRequests()
+	default:
+		c.Blocked = false
+	}
+}
+
+func (p Policy) halfOpenRequests() int {
+	return max(p.HalfOpenRequests, 1)
+}
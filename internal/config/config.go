@@ -5,17 +5,301 @@ import (
 	"os"
 )
 
+// BackendConfig описывает бэкенд и его вес в weighted round-robin.
+// В config.json бэкенд можно задать строкой с URL (вес 1) или объектом.
+// HealthCheck переопределяет поля глобальной проверки здоровья.
+type BackendConfig struct {
+	URL         string             `json:"url"`
+	Weight      int                `json:"weight"`
+	HealthCheck *HealthCheckConfig `json:"health_check"`
+}
+
+// HealthCheckConfig описывает проверку здоровья бэкенда. ExpectedStatus —
+// коды или диапазоны ("200", "200-299"); BodyContains и BodyRegex проверяют
+// тело ответа; TimeoutMs — таймаут одной проверки. IntervalMs, JitterMs и
+// Concurrency задают расписание проверок и учитываются только в глобальной секции.
+type HealthCheckConfig struct {
+	Path           string            `json:"path"`
+	Method         string            `json:"method"`
+	Headers        map[string]string `json:"headers"`
+	ExpectedStatus []string          `json:"expected_status"`
+	BodyContains   string            `json:"body_contains"`
+	BodyRegex      string            `json:"body_regex"`
+	TimeoutMs      int               `json:"timeout_ms"`
+	IntervalMs     int               `json:"interval_ms"`
+	JitterMs       int               `json:"jitter_ms"`
+	Concurrency    int               `json:"concurrency"`
+}
+
+// Merge возвращает проверку, в которой заданные в override поля заменяют текущие
+func (h HealthCheckConfig) Merge(override *HealthCheckConfig) HealthCheckConfig {
+	if override == nil {
+		return h
+	}
+	if override.Path != "" {
+		h.Path = override.Path
+	}
+	if override.Method != "" {
+		h.Method = override.Method
+	}
+	if override.Headers != nil {
+		h.Headers = override.Headers
+	}
+	if override.ExpectedStatus != nil {
+		h.ExpectedStatus = override.ExpectedStatus
+	}
+	if override.BodyContains != "" {
+		h.BodyContains = override.BodyContains
+	}
+	if override.BodyRegex != "" {
+		h.BodyRegex = override.BodyRegex
+	}
+	if override.TimeoutMs > 0 {
+		h.TimeoutMs = override.TimeoutMs
+	}
+	return h
+}
+
+func (b *BackendConfig) UnmarshalJSON(data []byte) error {
+	var rawurl string
+	if err := json.Unmarshal(data, &rawurl); err == nil {
+		b.URL = rawurl
+		b.Weight = 1
+		return nil
+	}
+
+	type backendAlias BackendConfig
+	var alias backendAlias
+	if err := json.Unmarshal(data, &alias); err != nil {
+		return err
+	}
+	if alias.Weight <= 0 {
+		alias.Weight = 1
+	}
+	*b = BackendConfig(alias)
+	return nil
+}
+
+// HealthPolicyConfig задает пороги смены состояния бэкенда: Rise успешных
+// или Fall неудачных проверок подряд. Если за FlapWindowMs состояние менялось
+// FlapThreshold раз, бэкенд удерживается недоступным HoldDownMs, с удвоением
+// при каждой следующей смене, но не дольше MaxHoldDownMs.
+type HealthPolicyConfig struct {
+	Rise          int `json:"rise"`
+	Fall          int `json:"fall"`
+	FlapWindowMs  int `json:"flap_window_ms"`
+	FlapThreshold int `json:"flap_threshold"`
+	HoldDownMs    int `json:"hold_down_ms"`
+	MaxHoldDownMs int `json:"max_hold_down_ms"`
+}
+
+// CircuitBreakerConfig задает circuit breaker для каждого бэкенда: цепь
+// размыкается, если за окно WindowMs было не меньше MinRequests запросов и
+// доля ошибок (5xx, таймауты, ошибки соединения) достигла FailureRatio.
+// Через OpenTimeoutMs пропускается HalfOpenRequests пробных запросов.
+type CircuitBreakerConfig struct {
+	Enabled          bool    `json:"enabled"`
+	WindowMs         int     `json:"window_ms"`
+	Buckets          int     `json:"buckets"`
+	MinRequests      int     `json:"min_requests"`
+	FailureRatio     float64 `json:"failure_ratio"`
+	OpenTimeoutMs    int     `json:"open_timeout_ms"`
+	HalfOpenRequests int     `json:"half_open_requests"`
+}
+
+// RetryConfig задает повторы запросов на другом бэкенде. Повторяются только
+// методы из Methods и только при кодах из StatusCodes, ошибках соединения
+// (OnConnectionError) или таймаутах (OnTimeout). Доля повторов ограничена
+// BudgetRatio от всех запросов плюс MinRetriesPerSec. Тело запроса
+// буферизуется до MaxBodyBytes; запросы с большим телом не повторяются.
+type RetryConfig struct {
+	MaxAttempts       int      `json:"max_attempts"`
+	Methods           []string `json:"methods"`
+	StatusCodes       []int    `json:"status_codes"`
+	OnConnectionError bool     `json:"on_connection_error"`
+	OnTimeout         bool     `json:"on_timeout"`
+	BudgetRatio       float64  `json:"budget_ratio"`
+	MinRetriesPerSec  int      `json:"min_retries_per_sec"`
+	BackoffMs         int      `json:"backoff_ms"`
+	MaxBackoffMs      int      `json:"max_backoff_ms"`
+	MaxBodyBytes      int64    `json:"max_body_bytes"`
+}
+
+// TransportConfig задает пул соединений к каждому бэкенду. KeepAliveMs < 0
+// отключает keep-alive; HTTP2 включает HTTP/2 для TLS-бэкендов.
+type TransportConfig struct {
+	MaxIdleConns            int  `json:"max_idle_conns"`
+	MaxIdleConnsPerHost     int  `json:"max_idle_conns_per_host"`
+	MaxConnsPerHost         int  `json:"max_conns_per_host"`
+	IdleConnTimeoutMs       int  `json:"idle_conn_timeout_ms"`
+	DialTimeoutMs           int  `json:"dial_timeout_ms"`
+	KeepAliveMs             int  `json:"keep_alive_ms"`
+	TLSHandshakeTimeoutMs   int  `json:"tls_handshake_timeout_ms"`
+	ResponseHeaderTimeoutMs int  `json:"response_header_timeout_ms"`
+	ExpectContinueTimeoutMs int  `json:"expect_continue_timeout_ms"`
+	HTTP2                   bool `json:"http2"`
+}
+
+// AccessLogConfig задает журнал доступа: формат "json", "logfmt" или
+// "combined" и вывод "stdout" или путь к файлу. Файл ротируется при
+// достижении MaxSizeMB, хранится MaxBackups старых копий.
+type AccessLogConfig struct {
+	Enabled    bool   `json:"enabled"`
+	Format     string `json:"format"`
+	Output     string `json:"output"`
+	MaxSizeMB  int    `json:"max_size_mb"`
+	MaxBackups int    `json:"max_backups"`
+}
+
+// IdentitySourceConfig — источник идентификатора клиента для rate-limit-а:
+// Type "ip", "header", "query", "cookie" или "jwt"; Name — имя заголовка,
+// параметра или cookie; Claim — поле JWT.
+type IdentitySourceConfig struct {
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Claim string `json:"claim"`
+}
+
+// PlanConfig — именованный план лимитов, на который ссылаются клиенты.
+// План из конфигурации создается при запуске, только если его еще нет в
+// plans_db: сохраненные планы не перезаписываются.
+type PlanConfig struct {
+	Name          string      `json:"name"`
+	Capacity      int         `json:"capacity"`
+	RatePerSec    int         `json:"rate_per_sec"`
+	Algorithm     string      `json:"algorithm"`
+	MaxConcurrent int         `json:"max_concurrent"`
+	Quota         QuotaConfig `json:"quota"`
+}
+
+// QuotaConfig — долгосрочная квота: Limit запросов за Period ("hour",
+// "day", "month") в окне Window ("calendar" или "rolling")
+type QuotaConfig struct {
+	Limit  int64  `json:"limit"`
+	Period string `json:"period"`
+	Window string `json:"window"`
+}
+
+// CostRuleConfig — стоимость запросов в токенах: первое правило, у которого
+// совпали метод и префикс пути (пустые — любые), задает Cost (по умолчанию 1).
+// Header — заголовок ответа бэкенда с фактической стоимостью, которая
+// дописывается после ответа.
+type CostRuleConfig struct {
+	Method     string `json:"method"`
+	PathPrefix string `json:"path_prefix"`
+	Cost       int    `json:"cost"`
+	Header     string `json:"header"`
+}
+
 type RateLimitConfig struct {
 	DefaultCapacity   int  `json:"default_capacity"`
 	DefaultRatePerSec int  `json:"default_rate_per_sec"`
 	RefillPeriod      int  `json:"refill_period"`
+	// DefaultAlgorithm — алгоритм для клиентов, у которых он не задан:
+	// "token_bucket" (по умолчанию), "gcra", "sliding_log" или "sliding_window"
+	DefaultAlgorithm string `json:"default_algorithm"`
+	// Identity — источники идентификатора клиента, перебираются по порядку
+	Identity []IdentitySourceConfig `json:"identity"`
+	// AnonymousPolicy — что делать с запросом без идентификатора:
+	// "shared" (общий бакет по умолчанию), "deny" или "allow"
+	AnonymousPolicy string `json:"anonymous_policy"`
+	// JWTSecret — ключ HS256 для проверки подписи JWT; обязателен для источника jwt
+	JWTSecret string `json:"jwt_secret"`
+	// Каждый незарегистрированный клиент получает свой бакет по умолчанию.
+	// Бакет удаляется после DefaultBucketTTLMs без запросов; если бакетов
+	// больше MaxDefaultBuckets, удаляется давно неиспользуемый.
+	DefaultBucketTTLMs int `json:"default_bucket_ttl_ms"`
+	MaxDefaultBuckets  int `json:"max_default_buckets"`
+	// QuotaFlushMs — как часто расход квот сохраняется вместе с клиентами
+	QuotaFlushMs       int `json:"quota_flush_ms"`
+	Distributed        DistributedConfig `json:"distributed"`
+	Concurrency        ConcurrencyConfig `json:"concurrency"`
+	CostRules          []CostRuleConfig  `json:"cost_rules"`
+	Plans              []PlanConfig      `json:"plans"`
+}
+
+// ConcurrencyConfig задает ограничение одновременных запросов клиента.
+// DefaultMax — лимит для незарегистрированных клиентов (0 — без ограничения).
+// Mode: "reject" — запрос сверх лимита сразу получает 429, "queue" — ждет
+// освобождения места не дольше MaxWaitMs; ждать могут не больше MaxQueue
+// запросов клиента.
+type ConcurrencyConfig struct {
+	DefaultMax int    `json:"default_max"`
+	Mode       string `json:"mode"`
+	MaxWaitMs  int    `json:"max_wait_ms"`
+	MaxQueue   int    `json:"max_queue"`
+}
+
+// DistributedConfig включает общий лимит для нескольких реплик. Mode:
+// "" — у каждой реплики свой лимит, "redis" — счетчики в Redis, "memory" —
+// в памяти процесса (замена Redis для тестов), "peers" — реплики рассылают
+// свои счетчики на служебные порты друг друга (Peers — их базовые URL),
+// подписывая их общим секретом PeerSecret.
+// FailPolicy при недоступности хранилища: "local" (по умолчанию) — лимиты
+// каждой реплики, "open" — пропускать, "closed" — отклонять.
+type DistributedConfig struct {
+	Mode           string   `json:"mode"`
+	RedisAddr      string   `json:"redis_addr"`
+	RedisPassword  string   `json:"redis_password"`
+	RedisDB        int      `json:"redis_db"`
+	PoolSize       int      `json:"pool_size"`
+	TimeoutMs      int      `json:"timeout_ms"`
+	Peers          []string `json:"peers"`
+	SyncIntervalMs int      `json:"sync_interval_ms"`
+	ReplicaID      string   `json:"replica_id"`
+	PeerSecret     string   `json:"peer_secret"`
+	FailPolicy     string   `json:"fail_policy"`
+}
+
+// ClientIPConfig задает определение реального IP клиента. Заголовкам
+// Headers ("Forwarded", "X-Forwarded-For") верим, только если соединение
+// пришло из TrustedProxies (CIDR или адреса). ProxyProtocol включает прием
+// заголовка PROXY protocol v1/v2 на основном порту; если TrustedProxies
+// заданы, заголовок принимается только от них.
+type ClientIPConfig struct {
+	TrustedProxies       []string `json:"trusted_proxies"`
+	Headers              []string `json:"headers"`
+	ProxyProtocol        bool     `json:"proxy_protocol"`
+	ProxyHeaderTimeoutMs int      `json:"proxy_header_timeout_ms"`
+}
+
+// HashKeyConfig задает ключ запроса для стратегии consistent_hash.
+// Source: "ip" (по умолчанию), "header", "cookie" или "path";
+// Name — имя заголовка или cookie.
+type HashKeyConfig struct {
+	Source string `json:"source"`
+	Name   string `json:"name"`
+}
+
+// StickySessionsConfig включает привязку клиента к бэкенду через подписанную
+// cookie. Если Secret пустой, ключ подписи генерируется при старте.
+type StickySessionsConfig struct {
+	Enabled    bool   `json:"enabled"`
+	CookieName string `json:"cookie_name"`
+	Secret     string `json:"secret"`
+	MaxAge     int    `json:"max_age"` // секунды; 0 — сессионная cookie
 }
 
 type Config struct {
 	Port      string         `json:"port"`
-	Backends  []string       `json:"backends"`
+	// AdminPort — порт служебного сервера с /metrics; пустой — не запускать
+	AdminPort string         `json:"admin_port"`
+	Backends  []BackendConfig `json:"backends"`
+	// BalancingStrategy: "round_robin" (по умолчанию), "least_connections",
+	// "peak_ewma" или "consistent_hash"
+	BalancingStrategy string        `json:"balancing_strategy"`
+	HashKey           HashKeyConfig `json:"hash_key"`
+	StickySessions    StickySessionsConfig `json:"sticky_sessions"`
+	HealthCheck       HealthCheckConfig `json:"health_check"`
+	HealthPolicy      HealthPolicyConfig `json:"health_policy"`
+	CircuitBreaker    CircuitBreakerConfig `json:"circuit_breaker"`
+	Retry             RetryConfig `json:"retry"`
+	Transport         TransportConfig `json:"transport"`
+	AccessLog         AccessLogConfig `json:"access_log"`
+	ClientIP          ClientIPConfig `json:"client_ip"`
 	RateLimit RateLimitConfig `json:"rate_limit"`
 	ClientsDB string         `json:"clients_db"`
+	PlansDB   string         `json:"plans_db"`
 }
 
 func LoadConfig(path string) (*Config, error) {
@@ -5,24 +5,219 @@ import (
 	"time"
 )
 
+// Административное состояние сервера
+const (
+	ServerActive   = "active"   // принимает запросы
+	ServerDisabled = "disabled" // выведен из балансировки
+	ServerDraining = "draining" // новые запросы не принимает, текущие завершаются
+)
+
 type Server struct {
 	URL     *url.URL
 	Healthy bool
+	State   string
+	Weight  int
+	// CurrentWeight — текущий вес для smooth weighted round-robin
+	CurrentWeight int
+	// ActiveRequests — число проксируемых в данный момент запросов (atomic)
+	ActiveRequests int64
+	// LatencyEWMA — peak-EWMA задержки ответа в наносекундах
+	LatencyEWMA    float64
+	LatencyUpdated time.Time
+
+	ConsecutiveSuccesses int
+	ConsecutiveFailures  int
+	// HoldUntil — до этого момента сервер считается недоступным из-за флаппинга
+	HoldUntil     time.Time
+	HealthHistory []HealthEvent
+
+	Circuit Circuit
+}
+
+// HealthEvent — смена состояния здоровья сервера
+type HealthEvent struct {
+	Healthy bool
+	Reason  string
+	At      time.Time
 }
 
-func NewServer(rawurl string) (*Server, error) {
+func NewServer(rawurl string, weight int) (*Server, error) {
 	u, err := url.Parse(rawurl)
 	if err != nil {
 		return nil, err
 	}
-	return &Server{URL: u, Healthy: true}, nil
+	if weight <= 0 {
+		weight = 1
+	}
+	return &Server{
+		URL:     u,
+		Healthy: true,
+		State:   ServerActive,
+		Weight:  weight,
+		Circuit: Circuit{State: CircuitClosed},
+	}, nil
+}
+
+// Available сообщает, можно ли отправить на сервер новый запрос
+func (s *Server) Available() bool {
+	return s.Healthy && s.State == ServerActive && !s.Circuit.Blocked
 }
 
+// Состояния circuit breaker
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half_open"
+)
+
+// Circuit — состояние circuit breaker сервера
+type Circuit struct {
+	State    string
+	OpenedAt time.Time
+	// Blocked — сервер не должен получать новые запросы: цепь разомкнута
+	// или заняты все пробные слоты half-open
+	Blocked        bool
+	Window         []CircuitBucket
+	TrialsInFlight int
+	TrialSuccesses int
+	History        []CircuitEvent
+	// Generation растет при каждом переходе: результат запроса, выбранного
+	// в другом поколении, не относится к текущему состоянию цепи
+	Generation uint64
+}
+
+// CircuitBucket — корзина скользящего окна запросов
+type CircuitBucket struct {
+	Start    time.Time
+	Requests int
+	Failures int
+}
+
+// CircuitEvent — переход circuit breaker между состояниями
+type CircuitEvent struct {
+	From   string
+	To     string
+	Reason string
+	At     time.Time
+}
+
+// Client — клиент rate-limit-а. Если задан Plan, ненулевые поля клиента
+// переопределяют соответствующие поля плана, а остальные берутся из плана.
 type Client struct {
 	ID           string
+	Plan         string
 	Capacity     int
 	RatePerSec   int
 	RefillPeriod time.Duration
+	// Algorithm — алгоритм rate-limit-а: "token_bucket", "gcra",
+	// "sliding_log" или "sliding_window"; пустой — алгоритм по умолчанию
+	Algorithm string
+	// MaxConcurrent — сколько запросов клиента может обрабатываться
+	// одновременно; 0 — без ограничения
+	MaxConcurrent int
+	// Quota — долгосрочная квота поверх ограничения частоты
+	Quota Quota
+	// Usage — расход квоты; сохраняется вместе с клиентом, чтобы пережить перезапуск
+	Usage QuotaUsage
+}
+
+// Периоды и окна квот
+const (
+	QuotaHour  = "hour"
+	QuotaDay   = "day"
+	QuotaMonth = "month"
+
+	QuotaCalendar = "calendar" // окно выровнено по границам часа, суток или месяца (UTC)
+	QuotaRolling  = "rolling"  // окно заканчивается в текущий момент
+)
+
+// Quota — не больше Limit запросов за Period ("hour", "day", "month") в
+// окне Window ("calendar" или "rolling"). Limit 0 — квоты нет.
+type Quota struct {
+	Limit  int64
+	Period string
+	Window string
+}
+
+// QuotaUsage — расход квоты. Для календарного окна это счетчик окна,
+// начавшегося в Start; для скользящего — счетчики коротких интервалов.
+type QuotaUsage struct {
+	Start   time.Time
+	Used    int64
+	Buckets []QuotaBucket `json:",omitempty"`
+}
+
+type QuotaBucket struct {
+	Start time.Time
+	Count int64
+}
+
+// QuotaReport — текущий расход квоты для API
+type QuotaReport struct {
+	Quota     Quota
+	Used      int64
+	Remaining int64
+	Start     time.Time // начало окна, за которое посчитан расход
+	ResetAt   time.Time // когда расход уменьшится: конец календарного окна или выход из скользящего окна старейшего интервала
+}
+
+// Plan — именованный тариф: лимиты, общие для всех клиентов плана
+type Plan struct {
+	Name          string
+	Capacity      int
+	RatePerSec    int
+	Algorithm     string
+	MaxConcurrent int
+	Quota         Quota
+}
+
+// PlanEvent — изменение плана в репозитории: сохранение или удаление
+type PlanEvent struct {
+	Plan    Plan
+	Deleted bool
+}
+
+// WithPlan возвращает копию клиента, в которой незаданные поля заполнены
+// из плана. plan может быть nil.
+func (c *Client) WithPlan(plan *Plan) *Client {
+	effective := *c
+	if plan == nil {
+		return &effective
+	}
+	if effective.Capacity == 0 {
+		effective.Capacity = plan.Capacity
+	}
+	if effective.RatePerSec == 0 {
+		effective.RatePerSec = plan.RatePerSec
+	}
+	if effective.Algorithm == "" {
+		effective.Algorithm = plan.Algorithm
+	}
+	if effective.MaxConcurrent == 0 {
+		effective.MaxConcurrent = plan.MaxConcurrent
+	}
+	if effective.Quota.Limit == 0 {
+		effective.Quota = plan.Quota
+	}
+	return &effective
+}
+
+// NoPlan в ClientOptions.Plan при обновлении клиента снимает с него план
+const NoPlan = "-"
+
+// ClientOptions — необязательные настройки клиента при регистрации и обновлении
+type ClientOptions struct {
+	Plan          string
+	Algorithm     string
+	MaxConcurrent int
+	Quota         Quota
+}
+
+// ClientEvent — изменение клиента в репозитории: сохранение или удаление.
+// Client — копия записи на момент изменения.
+type ClientEvent struct {
+	Client  Client
+	Deleted bool
 }
 
 func NewClient(id string, capacity, ratePerSec int) *Client {
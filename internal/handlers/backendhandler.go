@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"loadbalancer/internal/balancer"
+	"loadbalancer/internal/domain"
+	"loadbalancer/internal/interfaces/usecases"
+	util "loadbalancer/pkg/httputil"
+)
+
+type BackendHandler struct {
+	useCase usecases.BackendUseCase
+}
+
+func NewBackendHandler(uc usecases.BackendUseCase) *BackendHandler {
+	return &BackendHandler{useCase: uc}
+}
+
+type backendRequest struct {
+	URL    string `json:"url"`
+	Weight int    `json:"weight"`
+}
+
+type backendResponse struct {
+	URL     string `json:"url"`
+	Weight  int    `json:"weight"`
+	Healthy bool   `json:"healthy"`
+	State   string `json:"state"`
+	// ActiveRequests — число запросов, проксируемых на бэкенд прямо сейчас
+	ActiveRequests int64 `json:"active_requests"`
+	// Drained — бэкенд выведен из балансировки и на нем не осталось запросов
+	Drained bool `json:"drained"`
+	// LatencyMs — peak-EWMA задержки ответа, LatencyScore — стоимость выбора
+	// бэкенда для стратегии peak_ewma (меньше — лучше)
+	LatencyMs    float64 `json:"latency_ms"`
+	LatencyScore float64 `json:"latency_score"`
+
+	ConsecutiveFailures int                   `json:"consecutive_failures"`
+	HoldUntil           *time.Time            `json:"hold_until,omitempty"`
+	HealthHistory       []healthEventResponse `json:"health_history"`
+	Circuit             circuitResponse       `json:"circuit"`
+	Pool                poolResponse          `json:"pool"`
+}
+
+type poolResponse struct {
+	OpenConns  int64 `json:"open_conns"`
+	Dials      int64 `json:"dials"`
+	DialErrors int64 `json:"dial_errors"`
+	Requests   int64 `json:"requests"`
+	Reused     int64 `json:"reused"`
+}
+
+type circuitResponse struct {
+	State    string                 `json:"state"`
+	Requests int                    `json:"requests"`
+	Failures int                    `json:"failures"`
+	History  []circuitEventResponse `json:"history"`
+}
+
+type circuitEventResponse struct {
+	From   string    `json:"from"`
+	To     string    `json:"to"`
+	Reason string    `json:"reason"`
+	At     time.Time `json:"at"`
+}
+
+type healthEventResponse struct {
+	Healthy bool      `json:"healthy"`
+	Reason  string    `json:"reason"`
+	At      time.Time `json:"at"`
+}
+
+func newPoolResponse(stats util.ConnStats) poolResponse {
+	return poolResponse{
+		OpenConns:  stats.Open,
+		Dials:      stats.Dials,
+		DialErrors: stats.DialErrors,
+		Requests:   stats.Requests,
+		Reused:     stats.Reused,
+	}
+}
+
+func newBackendResponse(server *domain.Server, stats util.ConnStats, now time.Time) backendResponse {
+	history := make([]healthEventResponse, 0, len(server.HealthHistory))
+	for _, event := range server.HealthHistory {
+		history = append(history, healthEventResponse{
+			Healthy: event.Healthy,
+			Reason:  event.Reason,
+			At:      event.At,
+		})
+	}
+
+	circuit := circuitResponse{
+		State:   server.Circuit.State,
+		History: make([]circuitEventResponse, 0, len(server.Circuit.History)),
+	}
+	for _, bucket := range server.Circuit.Window {
+		circuit.Requests += bucket.Requests
+		circuit.Failures += bucket.Failures
+	}
+	for _, event := range server.Circuit.History {
+		circuit.History = append(circuit.History, circuitEventResponse{
+			From:   event.From,
+			To:     event.To,
+			Reason: event.Reason,
+			At:     event.At,
+		})
+	}
+
+	var holdUntil *time.Time
+	if server.HoldUntil.After(now) {
+		holdUntil = &server.HoldUntil
+	}
+
+	return backendResponse{
+		URL:            server.URL.String(),
+		Weight:         server.Weight,
+		Healthy:        server.Healthy,
+		State:          server.State,
+		ActiveRequests: server.ActiveRequests,
+		Drained:        server.State != domain.ServerActive && server.ActiveRequests == 0,
+		LatencyMs:      server.LatencyEWMA / float64(time.Millisecond),
+		LatencyScore:   balancer.LatencyScore(server, now),
+
+		ConsecutiveFailures: server.ConsecutiveFailures,
+		HoldUntil:           holdUntil,
+		HealthHistory:       history,
+		Circuit:             circuit,
+		Pool:                newPoolResponse(stats),
+	}
+}
+
+func (h *BackendHandler) ListBackends(w http.ResponseWriter, r *http.Request) {
+	servers := h.useCase.ListBackends()
+
+	now := time.Now()
+	backends := make([]backendResponse, 0, len(servers))
+	for _, server := range servers {
+		backends = append(backends, newBackendResponse(server, h.useCase.ConnStats(server), now))
+	}
+
+	respondWithJSON(w, http.StatusOK, backends)
+}
+
+func (h *BackendHandler) AddBackend(w http.ResponseWriter, r *http.Request) {
+	var req backendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	server, err := h.useCase.AddBackend(req.URL, req.Weight)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, newBackendResponse(server, h.useCase.ConnStats(server), time.Now()))
+}
+
+func (h *BackendHandler) UpdateWeight(w http.ResponseWriter, r *http.Request) {
+	var req backendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	server, err := h.useCase.UpdateWeight(req.URL, req.Weight)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, newBackendResponse(server, h.useCase.ConnStats(server), time.Now()))
+}
+
+func (h *BackendHandler) RemoveBackend(w http.ResponseWriter, r *http.Request) {
+	rawurl := r.URL.Query().Get("url")
+	if rawurl == "" {
+		respondWithError(w, http.StatusBadRequest, "backend URL is required")
+		return
+	}
+
+	if err := h.useCase.RemoveBackend(rawurl); err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *BackendHandler) EnableBackend(w http.ResponseWriter, r *http.Request) {
+	h.changeState(w, r, h.useCase.EnableBackend)
+}
+
+func (h *BackendHandler) DisableBackend(w http.ResponseWriter, r *http.Request) {
+	h.changeState(w, r, h.useCase.DisableBackend)
+}
+
+func (h *BackendHandler) DrainBackend(w http.ResponseWriter, r *http.Request) {
+	h.changeState(w, r, h.useCase.DrainBackend)
+}
+
+func (h *BackendHandler) changeState(w http.ResponseWriter, r *http.Request, change func(string) (*domain.Server, error)) {
+	rawurl := r.URL.Query().Get("url")
+	if rawurl == "" {
+		respondWithError(w, http.StatusBadRequest, "backend URL is required")
+		return
+	}
+
+	server, err := change(rawurl)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, newBackendResponse(server, h.useCase.ConnStats(server), time.Now()))
+}
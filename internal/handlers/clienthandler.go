@@ -3,7 +3,9 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"time"
 
+	"loadbalancer/internal/domain"
 	"loadbalancer/internal/interfaces/usecases"
 )
 
@@ -17,8 +19,48 @@ func NewClientHandler(uc usecases.ClientUseCase) *ClientHandler {
 
 type clientRequest struct {
 	ID         string `json:"client_id"`
+	Plan       string `json:"plan"` // нулевые поля клиента берутся из плана; при обновлении "-" снимает план
 	Capacity   int    `json:"capacity"`
 	RatePerSec int    `json:"rate_per_sec"`
+	Algorithm  string `json:"algorithm"`
+	// MaxConcurrent — лимит одновременных запросов; при обновлении -1 снимает его
+	MaxConcurrent int `json:"max_concurrent"`
+	// Quota — долгосрочная квота; при обновлении limit -1 снимает ее
+	Quota quotaRequest `json:"quota"`
+}
+
+type quotaRequest struct {
+	Limit  int64  `json:"limit"`
+	Period string `json:"period"` // "hour", "day" или "month"
+	Window string `json:"window"` // "calendar" или "rolling"
+}
+
+func (req clientRequest) options() domain.ClientOptions {
+	return domain.ClientOptions{
+		Plan:          req.Plan,
+		Algorithm:     req.Algorithm,
+		MaxConcurrent: req.MaxConcurrent,
+		Quota:         req.Quota.quota(),
+	}
+}
+
+func (req quotaRequest) quota() domain.Quota {
+	return domain.Quota{
+		Limit:  req.Limit,
+		Period: req.Period,
+		Window: req.Window,
+	}
+}
+
+type usageResponse struct {
+	ClientID    string    `json:"client_id"`
+	Limit       int64     `json:"limit"`
+	Period      string    `json:"period,omitempty"`
+	Window      string    `json:"window,omitempty"`
+	Used        int64     `json:"used"`
+	Remaining   int64     `json:"remaining"`
+	WindowStart time.Time `json:"window_start"`
+	ResetAt     time.Time `json:"reset_at"`
 }
 
 type errorResponse struct {
@@ -33,7 +75,7 @@ func (h *ClientHandler) RegisterClient(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	client, err := h.useCase.RegisterClient(req.ID, req.Capacity, req.RatePerSec)
+	client, err := h.useCase.RegisterClient(req.ID, req.Capacity, req.RatePerSec, req.options())
 	if err != nil {
 		respondWithError(w, http.StatusBadRequest, err.Error())
 		return
@@ -49,7 +91,7 @@ func (h *ClientHandler) UpdateClient(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	client, err := h.useCase.UpdateClient(req.ID, req.Capacity, req.RatePerSec)
+	client, err := h.useCase.UpdateClient(req.ID, req.Capacity, req.RatePerSec, req.options())
 	if err != nil {
 		respondWithError(w, http.StatusBadRequest, err.Error())
 		return
@@ -89,6 +131,28 @@ func (h *ClientHandler) GetClient(w http.ResponseWriter, r *http.Request) {
 	respondWithJSON(w, http.StatusOK, client)
 }
 
+// GetUsage отдает расход квоты клиента: GET /clients/{id}/usage.
+// Для клиента без квоты limit равен 0.
+func (h *ClientHandler) GetUsage(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	report, err := h.useCase.GetUsage(id)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, usageResponse{
+		ClientID:    id,
+		Limit:       report.Quota.Limit,
+		Period:      report.Quota.Period,
+		Window:      report.Quota.Window,
+		Used:        report.Used,
+		Remaining:   report.Remaining,
+		WindowStart: report.Start,
+		ResetAt:     report.ResetAt,
+	})
+}
+
 func (h *ClientHandler) ListClients(w http.ResponseWriter, r *http.Request) {
 	clients, err := h.useCase.ListClients()
 	if err != nil {
@@ -1,12 +1,14 @@
 package handlers
 
 import (
-	"net"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"loadbalancer/internal/accesslog"
 	"loadbalancer/internal/interfaces/handlers"
-	"loadbalancer/internal/interfaces/repositories"
 	"loadbalancer/internal/interfaces/usecases"
 	"loadbalancer/internal/ratelimiter"
 )
@@ -14,44 +16,125 @@ import (
 type loadBalancerHandler struct {
     useCase usecases.LoadBalancerUseCase
     limiterManager *ratelimiter.LimiterManager
+    identifier *ratelimiter.Identifier
+    costs *ratelimiter.CostRules
 }
 
 func NewLoadBalancerHandler(
 	uc usecases.LoadBalancerUseCase,
-	clientRepo repositories.ClientRepository,
-	defaultCapacity int,
-	defaultRatePerSec int,
-	refillPeriod time.Duration,
+	limiter *ratelimiter.LimiterManager,
+	identifier *ratelimiter.Identifier,
+	costs *ratelimiter.CostRules,
 ) handlers.LoadBalancerHandler {
-	limiter := ratelimiter.NewLimiterManager(
-		clientRepo,
-		defaultCapacity,
-		defaultRatePerSec,
-		refillPeriod,
-	)
 	return &loadBalancerHandler{
 		useCase:        uc,
 		limiterManager: limiter,
+		identifier:     identifier,
+		costs:          costs,
 	}
 }
 func (h *loadBalancerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-    ip, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		http.Error(w, "Failed to parse IP address", http.StatusBadRequest)
-		return
+	entry := accesslog.FromContext(r.Context())
+
+	identity, ok := h.identifier.Identify(r)
+	clientID := identity.ID
+	if !ok {
+		switch h.identifier.AnonymousPolicy() {
+		case ratelimiter.AnonymousDeny:
+			entry.RateLimit = "denied"
+			respondWithError(w, http.StatusUnauthorized, "client identity required")
+			return
+		case ratelimiter.AnonymousAllow:
+			// Анонимный трафик не ограничивается, поэтому заголовки
+			// RateLimit-* ему не выставляются
+			entry.RateLimit = "allowed"
+			h.useCase.HandleRequest(w, r)
+			return
+		}
+		clientID = ratelimiter.AnonymousClientID
+	} else if identity.Source != ratelimiter.IdentityIP && !h.limiterManager.Registered(clientID) {
+		// Собственный бакет по умолчанию получают только адреса
+		clientID = ratelimiter.FallbackID(r)
 	}
 
-	clientIP := net.ParseIP(ip)
-	if clientIP == nil {
-		http.Error(w, "Invalid IP address", http.StatusBadRequest)
+	entry.ClientID = clientID
+	cost := h.costs.Match(r)
+
+	// Место среди одновременных запросов занимается до списания токенов и
+	// квоты: запрос, не дождавшийся места, не должен их расходовать
+	release, err := h.limiterManager.Acquire(r.Context(), clientID)
+	if err != nil {
+		entry.RateLimit = "concurrency_limited"
+		// Когда освободится место, заранее неизвестно, поэтому повтор
+		// предлагается через секунду или позже, если раньше не хватит токенов
+		status := h.limiterManager.Peek(clientID, cost.Cost)
+		setRateLimitHeaders(w.Header(), status)
+		retryAfter := ceilSeconds(status.RetryAfter)
+		if retryAfter < 1 {
+			retryAfter = 1
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		respondWithError(w, http.StatusTooManyRequests, err.Error())
 		return
 	}
+	// Место освобождается, когда ответ бэкенда полностью отправлен клиенту
+	defer release()
 
-	if !h.limiterManager.Allow(clientIP) {
-		http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+	entry.Cost = cost.Cost
+	result := h.limiterManager.Allow(clientID, cost.Cost)
+	setRateLimitHeaders(w.Header(), result)
+	if !result.Allowed {
+		entry.RateLimit = "denied"
+		w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+		message := "rate limit exceeded"
+		if result.Quota != nil && result.Limit == 0 {
+			entry.RateLimit = "quota_exceeded"
+			message = "quota exceeded"
+		}
+		respondWithError(w, http.StatusTooManyRequests, message)
 		return
 	}
+	entry.RateLimit = "allowed"
 
 	// Иначе — пропускаем запрос
     h.useCase.HandleRequest(w, r)
-}
\ No newline at end of file
+
+	// Фактическая стоимость из ответа бэкенда списывается задним числом
+	if extra := cost.Extra(w.Header()); extra > 0 {
+		entry.Cost += extra
+		h.limiterManager.Debit(clientID, extra)
+	}
+}
+
+// setRateLimitHeaders выставляет заголовки RateLimit-* по черновику IETF
+// httpapi-ratelimit-headers. Политика описывает бакет как квоту Limit
+// запросов за окно w — время полного заполнения пустого бакета, а
+// долгосрочную квоту — как вторую политику. Limit, Remaining и Reset
+// относятся к той политике, у которой осталось меньше запросов.
+func setRateLimitHeaders(header http.Header, result ratelimiter.Result) {
+	limit, remaining, reset := int64(result.Limit), int64(result.Remaining), result.Reset
+	var policies []string
+	if result.Quota == nil || result.Limit > 0 {
+		policies = append(policies, fmt.Sprintf("%d;w=%d", result.Limit, ceilSeconds(result.Window)))
+	}
+	if quota := result.Quota; quota != nil {
+		window := ratelimiter.QuotaWindow(quota.Quota.Period)
+		policies = append(policies, fmt.Sprintf("%d;w=%d", quota.Quota.Limit, ceilSeconds(window)))
+		if result.Limit == 0 || quota.Remaining < remaining {
+			limit, remaining, reset = quota.Quota.Limit, quota.Remaining, time.Until(quota.ResetAt)
+		}
+	}
+
+	header.Set("RateLimit-Limit", strconv.FormatInt(limit, 10))
+	header.Set("RateLimit-Remaining", strconv.FormatInt(remaining, 10))
+	header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(reset)))
+	header.Set("RateLimit-Policy", strings.Join(policies, ", "))
+}
+
+// ceilSeconds округляет длительность вверх до целых секунд
+func ceilSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int((d + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"loadbalancer/internal/domain"
+	"loadbalancer/internal/interfaces/usecases"
+)
+
+type PlanHandler struct {
+	useCase usecases.PlanUseCase
+}
+
+func NewPlanHandler(uc usecases.PlanUseCase) *PlanHandler {
+	return &PlanHandler{useCase: uc}
+}
+
+type planRequest struct {
+	Name          string       `json:"name"`
+	Capacity      int          `json:"capacity"`
+	RatePerSec    int          `json:"rate_per_sec"`
+	Algorithm     string       `json:"algorithm"`
+	MaxConcurrent int          `json:"max_concurrent"`
+	Quota         quotaRequest `json:"quota"`
+}
+
+// SavePlan создает или заменяет план; изменения сразу действуют для всех
+// его клиентов
+func (h *PlanHandler) SavePlan(w http.ResponseWriter, r *http.Request) {
+	var req planRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	plan := &domain.Plan{
+		Name:          req.Name,
+		Capacity:      req.Capacity,
+		RatePerSec:    req.RatePerSec,
+		Algorithm:     req.Algorithm,
+		MaxConcurrent: req.MaxConcurrent,
+		Quota:         req.Quota.quota(),
+	}
+	if err := h.useCase.SavePlan(plan); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, plan)
+}
+
+func (h *PlanHandler) DeletePlan(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		respondWithError(w, http.StatusBadRequest, "plan name is required")
+		return
+	}
+
+	if err := h.useCase.DeletePlan(name); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *PlanHandler) GetPlan(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		respondWithError(w, http.StatusBadRequest, "plan name is required")
+		return
+	}
+
+	plan, err := h.useCase.GetPlan(name)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, plan)
+}
+
+func (h *PlanHandler) ListPlans(w http.ResponseWriter, r *http.Request) {
+	plans, err := h.useCase.ListPlans()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, plans)
+}
@@ -0,0 +1,88 @@
+package health
+
+import (
+	"time"
+
+	"loadbalancer/internal/domain"
+)
+
+// HistorySize — сколько последних смен состояния хранится для каждого сервера
+const HistorySize = 20
+
+// Policy определяет, когда результаты проверок меняют состояние сервера.
+// Сервер становится недоступным после Fall неудачных проверок подряд и
+// доступным после Rise успешных. Если за FlapWindow состояние менялось
+// FlapThreshold раз и больше, сервер удерживается недоступным HoldDown,
+// и это время удваивается с каждой следующей сменой, но не превышает MaxHoldDown.
+type Policy struct {
+	Rise          int
+	Fall          int
+	FlapWindow    time.Duration
+	FlapThreshold int
+	HoldDown      time.Duration
+	MaxHoldDown   time.Duration
+}
+
+// Observe учитывает результат проверки и возвращает true, если состояние
+// сервера изменилось. Вызывается под блокировкой репозитория.
+func (p Policy) Observe(server *domain.Server, ok bool, reason string, now time.Time) bool {
+	if ok {
+		server.ConsecutiveSuccesses++
+		server.ConsecutiveFailures = 0
+	} else {
+		server.ConsecutiveFailures++
+		server.ConsecutiveSuccesses = 0
+	}
+
+	switch {
+	case server.Healthy && !ok && server.ConsecutiveFailures >= max(p.Fall, 1):
+		server.Healthy = false
+		p.record(server, reason, now)
+		if hold := p.holdDown(server, now); hold > 0 {
+			server.HoldUntil = now.Add(hold)
+		}
+		return true
+	case !server.Healthy && ok && server.ConsecutiveSuccesses >= max(p.Rise, 1) && !now.Before(server.HoldUntil):
+		server.Healthy = true
+		p.record(server, reason, now)
+		return true
+	}
+	return false
+}
+
+func (p Policy) record(server *domain.Server, reason string, now time.Time) {
+	server.HealthHistory = append(server.HealthHistory, domain.HealthEvent{
+		Healthy: server.Healthy,
+		Reason:  reason,
+		At:      now,
+	})
+	if len(server.HealthHistory) > HistorySize {
+		server.HealthHistory = server.HealthHistory[len(server.HealthHistory)-HistorySize:]
+	}
+}
+
+// holdDown возвращает, на сколько удержать сервер недоступным из-за флаппинга
+func (p Policy) holdDown(server *domain.Server, now time.Time) time.Duration {
+	if p.FlapThreshold <= 0 || p.HoldDown <= 0 {
+		return 0
+	}
+
+	flaps := 0
+	for _, event := range server.HealthHistory {
+		if now.Sub(event.At) <= p.FlapWindow {
+			flaps++
+		}
+	}
+	if flaps < p.FlapThreshold {
+		return 0
+	}
+
+	hold := p.HoldDown
+	for i := p.FlapThreshold; i < flaps; i++ {
+		hold *= 2
+		if p.MaxHoldDown > 0 && hold >= p.MaxHoldDown {
+			return p.MaxHoldDown
+		}
+	}
+	return hold
+}
@@ -7,4 +7,9 @@ type ClientRepository interface {
 	FindByID(id string) (*domain.Client, error)
 	Delete(id string) error
 	FindAll() ([]*domain.Client, error)
+	// UpdateUsage сохраняет расход квот клиентов без уведомления подписчиков
+	UpdateUsage(usages map[string]domain.QuotaUsage) error
+	// Subscribe регистрирует обработчик, который вызывается после каждого
+	// успешного сохранения или удаления клиента
+	Subscribe(listener func(domain.ClientEvent))
 }
\ No newline at end of file
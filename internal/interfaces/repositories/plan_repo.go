@@ -0,0 +1,13 @@
+package repositories
+
+import "loadbalancer/internal/domain"
+
+type PlanRepository interface {
+	Save(plan *domain.Plan) error
+	FindByName(name string) (*domain.Plan, error)
+	Delete(name string) error
+	FindAll() ([]*domain.Plan, error)
+	// Subscribe регистрирует обработчик, который вызывается после каждого
+	// успешного сохранения или удаления плана
+	Subscribe(listener func(domain.PlanEvent))
+}
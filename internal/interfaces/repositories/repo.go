@@ -1,11 +1,27 @@
 package repositories
 
-import "loadbalancer/internal/domain"
+import (
+	"time"
+
+	"loadbalancer/internal/balancer"
+	"loadbalancer/internal/breaker"
+	"loadbalancer/internal/domain"
+)
 
 type ServerRepository interface {
-	GetNext() (*domain.Server, error)
-	MarkUnhealthy(server *domain.Server) error
+	// GetNext и Get возвращают вместе с сервером поколение circuit breaker,
+	// в котором он выбран; его нужно передать в ReportResult
+	GetNext(sel balancer.Selection) (*domain.Server, uint64, error)
+	Get(rawurl string) (*domain.Server, uint64, error)
+	ReportResult(server *domain.Server, generation uint64, outcome breaker.Outcome, reason string)
 	Count() int
 	GetAll() []*domain.Server
 	UpdateHealth(server *domain.Server, healthy bool)
+	Acquire(server *domain.Server)
+	Release(server *domain.Server)
+	ObserveLatency(server *domain.Server, rtt time.Duration)
+	Add(server *domain.Server) (*domain.Server, error)
+	Remove(rawurl string) error
+	SetState(rawurl, state string) (*domain.Server, error)
+	SetWeight(rawurl string, weight int) (*domain.Server, error)
 }
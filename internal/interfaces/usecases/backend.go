@@ -0,0 +1,17 @@
+package usecases
+
+import (
+	"loadbalancer/internal/domain"
+	util "loadbalancer/pkg/httputil"
+)
+
+type BackendUseCase interface {
+	ListBackends() []*domain.Server
+	AddBackend(rawurl string, weight int) (*domain.Server, error)
+	RemoveBackend(rawurl string) error
+	EnableBackend(rawurl string) (*domain.Server, error)
+	DisableBackend(rawurl string) (*domain.Server, error)
+	DrainBackend(rawurl string) (*domain.Server, error)
+	UpdateWeight(rawurl string, weight int) (*domain.Server, error)
+	ConnStats(server *domain.Server) util.ConnStats
+}
@@ -3,9 +3,11 @@ package usecases
 import "loadbalancer/internal/domain"
 
 type ClientUseCase interface {
-	RegisterClient(id string, capacity, ratePerSec int) (*domain.Client, error)
-	UpdateClient(id string, capacity, ratePerSec int) (*domain.Client, error)
+	RegisterClient(id string, capacity, ratePerSec int, opts domain.ClientOptions) (*domain.Client, error)
+	UpdateClient(id string, capacity, ratePerSec int, opts domain.ClientOptions) (*domain.Client, error)
 	DeleteClient(id string) error
 	GetClient(id string) (*domain.Client, error)
 	ListClients() ([]*domain.Client, error)
+	// GetUsage возвращает текущий расход долгосрочной квоты клиента
+	GetUsage(id string) (*domain.QuotaReport, error)
 }
\ No newline at end of file
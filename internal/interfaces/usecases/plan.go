@@ -0,0 +1,10 @@
+package usecases
+
+import "loadbalancer/internal/domain"
+
+type PlanUseCase interface {
+	SavePlan(plan *domain.Plan) error
+	DeletePlan(name string) error
+	GetPlan(name string) (*domain.Plan, error)
+	ListPlans() ([]*domain.Plan, error)
+}
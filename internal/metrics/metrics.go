@@ -0,0 +1,78 @@
+// Package metrics описывает метрики балансировщика, которые отдаются на
+// эндпоинте /metrics админского порта.
+package metrics
+
+import prom "loadbalancer/pkg/metrics"
+
+var Registry = prom.NewRegistry()
+
+// ForgetBackend удаляет все ряды удаленного бэкенда, чтобы число рядов не
+// росло при добавлении и удалении бэкендов
+func ForgetBackend(backend string) {
+	Requests.DeletePrefix(backend)
+	RequestDuration.DeletePrefix(backend)
+	Retries.DeletePrefix(backend)
+	BackendInFlight.DeletePrefix(backend)
+	BackendHealthy.DeletePrefix(backend)
+	HealthTransitions.DeletePrefix(backend)
+	CircuitTransitions.DeletePrefix(backend)
+}
+
+var (
+	Requests = Registry.NewCounterVec(
+		"lb_backend_requests_total",
+		"Proxied requests by backend and response status code.",
+		"backend", "code",
+	)
+	RequestDuration = Registry.NewHistogramVec(
+		"lb_backend_request_duration_seconds",
+		"Duration of proxied requests by backend and response status code.",
+		prom.DefBuckets,
+		"backend", "code",
+	)
+	Retries = Registry.NewCounterVec(
+		"lb_retries_total",
+		"Requests retried on another backend, by the backend that failed.",
+		"backend",
+	)
+	InFlight = Registry.NewGaugeVec(
+		"lb_inflight_requests",
+		"Requests currently being handled by the load balancer.",
+	)
+	BackendInFlight = Registry.NewGaugeVec(
+		"lb_backend_inflight_requests",
+		"Requests currently being proxied to a backend.",
+		"backend",
+	)
+
+	BackendHealthy = Registry.NewGaugeVec(
+		"lb_backend_healthy",
+		"Whether the backend passes health checks (1) or not (0).",
+		"backend",
+	)
+	HealthTransitions = Registry.NewCounterVec(
+		"lb_backend_health_transitions_total",
+		"Backend health state changes by the new state.",
+		"backend", "state",
+	)
+	CircuitTransitions = Registry.NewCounterVec(
+		"lb_backend_circuit_transitions_total",
+		"Circuit breaker state changes by the new state.",
+		"backend", "state",
+	)
+
+	RateLimitDecisions = Registry.NewCounterVec(
+		"lb_ratelimit_requests_total",
+		"Rate limiter decisions by registered client (unregistered ones are counted as default or anonymous) and result (allowed, denied, quota_exceeded or concurrency_limited).",
+		"client", "result",
+	)
+	RateLimitBuckets = Registry.NewGaugeVec(
+		"lb_ratelimit_buckets",
+		"Token buckets currently held by the rate limiter, for registered clients (client) and unregistered ones (default).",
+		"kind",
+	)
+	RateLimitStoreErrors = Registry.NewCounterVec(
+		"lb_ratelimit_store_errors_total",
+		"Failed requests to the shared rate limit store.",
+	)
+)
@@ -0,0 +1,138 @@
+package ratelimiter
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Что делать с запросом сверх лимита одновременных запросов
+const (
+	ConcurrencyReject = "reject" // сразу отклонять
+	ConcurrencyQueue  = "queue"  // ждать освобождения не дольше MaxWait
+)
+
+// ErrConcurrencyLimit — у клиента слишком много запросов в обработке
+var ErrConcurrencyLimit = errors.New("too many concurrent requests")
+
+// Concurrency — настройки ограничения одновременных запросов.
+// DefaultMax применяется к незарегистрированным клиентам; 0 — без ограничения.
+type Concurrency struct {
+	DefaultMax int
+	Mode       string
+	MaxWait    time.Duration
+	MaxQueue   int // сколько запросов клиента может ждать одновременно
+}
+
+// slots — занятые места и очередь ожидающих одного клиента
+type slots struct {
+	limit   int
+	active  int
+	waiters *list.List // chan struct{}, по порядку прихода
+}
+
+// ConcurrencyLimiter ограничивает число запросов клиента в обработке
+type ConcurrencyLimiter struct {
+	settings Concurrency
+	clients  map[string]*slots
+	mu       sync.Mutex
+}
+
+func NewConcurrencyLimiter(settings Concurrency) (*ConcurrencyLimiter, error) {
+	switch settings.Mode {
+	case "":
+		settings.Mode = ConcurrencyReject
+	case ConcurrencyReject, ConcurrencyQueue:
+	default:
+		return nil, fmt.Errorf("unknown concurrency mode %q", settings.Mode)
+	}
+	return &ConcurrencyLimiter{
+		settings: settings,
+		clients:  make(map[string]*slots),
+	}, nil
+}
+
+// Acquire занимает место для запроса клиента с лимитом limit (0 — без
+// ограничения). Вызывающий обязан вызвать release, когда ответ отправлен.
+func (c *ConcurrencyLimiter) Acquire(ctx context.Context, clientID string, limit int) (release func(), err error) {
+	if limit <= 0 {
+		return func() {}, nil
+	}
+
+	c.mu.Lock()
+	s, exists := c.clients[clientID]
+	if !exists {
+		s = &slots{waiters: list.New()}
+		c.clients[clientID] = s
+	}
+	// Лимит берется из текущих настроек клиента, поэтому изменения действуют сразу
+	s.limit = limit
+	release = func() { c.release(clientID, s) }
+
+	if s.active < s.limit && s.waiters.Len() == 0 {
+		s.active++
+		c.mu.Unlock()
+		return release, nil
+	}
+	if c.settings.Mode != ConcurrencyQueue || c.settings.MaxWait <= 0 ||
+		(c.settings.MaxQueue > 0 && s.waiters.Len() >= c.settings.MaxQueue) {
+		c.cleanup(clientID, s)
+		c.mu.Unlock()
+		return nil, ErrConcurrencyLimit
+	}
+
+	ready := make(chan struct{}, 1)
+	el := s.waiters.PushBack(ready)
+	c.mu.Unlock()
+
+	timer := time.NewTimer(c.settings.MaxWait)
+	defer timer.Stop()
+	select {
+	case <-ready:
+		return release, nil
+	case <-timer.C:
+		err = ErrConcurrencyLimit
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-ready:
+		// Место освободилось одновременно с таймаутом — отдаем его следующему
+		c.releaseLocked(clientID, s)
+	default:
+		s.waiters.Remove(el)
+		c.cleanup(clientID, s)
+	}
+	return nil, err
+}
+
+func (c *ConcurrencyLimiter) release(clientID string, s *slots) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.releaseLocked(clientID, s)
+}
+
+// releaseLocked освобождает место и передает его ожидающим. Вызывается под c.mu.
+func (c *ConcurrencyLimiter) releaseLocked(clientID string, s *slots) {
+	s.active--
+	for s.active < s.limit && s.waiters.Len() > 0 {
+		ready := s.waiters.Remove(s.waiters.Front()).(chan struct{})
+		s.active++
+		ready <- struct{}{}
+	}
+	c.cleanup(clientID, s)
+}
+
+// cleanup удаляет запись клиента без запросов, чтобы карта не росла.
+// Вызывается под c.mu.
+func (c *ConcurrencyLimiter) cleanup(clientID string, s *slots) {
+	if s.active == 0 && s.waiters.Len() == 0 && c.clients[clientID] == s {
+		delete(c.clients, clientID)
+	}
+}
@@ -0,0 +1,196 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNewConcurrencyLimiter(t *testing.T) {
+	tests := []struct {
+		mode string
+		err  bool
+	}{
+		{mode: ""},
+		{mode: ConcurrencyReject},
+		{mode: ConcurrencyQueue},
+		{mode: "lifo", err: true},
+	}
+
+	for _, tt := range tests {
+		_, err := NewConcurrencyLimiter(Concurrency{Mode: tt.mode})
+		if (err != nil) != tt.err {
+			t.Errorf("mode %q: err = %v, want error %v", tt.mode, err, tt.err)
+		}
+	}
+}
+
+func TestConcurrencyLimiterAcquire(t *testing.T) {
+	const wait = 200 * time.Millisecond
+	tests := []struct {
+		name     string
+		settings Concurrency
+		limit    int
+		held     int           // сколько запросов уже в обработке
+		waiting  int           // сколько запросов уже ждет в очереди
+		release  time.Duration // через сколько освобождается одно место; 0 — не освобождается
+		ctxAfter time.Duration // через сколько отменяется запрос; 0 — не отменяется
+		err      error
+	}{
+		{name: "unlimited", limit: 0, held: 100},
+		{name: "free slot", limit: 2, held: 1},
+		{name: "reject when full", limit: 2, held: 2, err: ErrConcurrencyLimit},
+		{
+			name:     "queue disabled without max wait",
+			settings: Concurrency{Mode: ConcurrencyQueue},
+			limit:    1, held: 1,
+			err: ErrConcurrencyLimit,
+		},
+		{
+			name:     "queued request gets released slot",
+			settings: Concurrency{Mode: ConcurrencyQueue, MaxWait: wait},
+			limit:    1, held: 1, release: wait / 4,
+		},
+		{
+			name:     "queued request times out",
+			settings: Concurrency{Mode: ConcurrencyQueue, MaxWait: wait / 4},
+			limit:    1, held: 1,
+			err: ErrConcurrencyLimit,
+		},
+		{
+			name:     "full queue rejects at once",
+			settings: Concurrency{Mode: ConcurrencyQueue, MaxWait: wait, MaxQueue: 1},
+			limit:    1, held: 1, waiting: 1,
+			err: ErrConcurrencyLimit,
+		},
+		{
+			name:     "earlier waiter is served first",
+			settings: Concurrency{Mode: ConcurrencyQueue, MaxWait: wait / 2},
+			limit:    1, held: 1, waiting: 1, release: wait / 8,
+			err: ErrConcurrencyLimit,
+		},
+		{
+			name:     "cancelled request leaves the queue",
+			settings: Concurrency{Mode: ConcurrencyQueue, MaxWait: wait},
+			limit:    1, held: 1, ctxAfter: wait / 4,
+			err: context.Canceled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewConcurrencyLimiter(tt.settings)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var releases []func()
+			for i := 0; i < tt.held; i++ {
+				release, err := c.Acquire(context.Background(), "client", tt.limit)
+				if err != nil {
+					t.Fatalf("held request %d: %v", i, err)
+				}
+				releases = append(releases, release)
+			}
+			waiters := make(chan func(), tt.waiting)
+			for i := 0; i < tt.waiting; i++ {
+				go func() {
+					release, _ := c.Acquire(context.Background(), "client", tt.limit)
+					waiters <- release
+				}()
+			}
+			// Ожидающие встают в очередь раньше проверяемого запроса
+			waitQueue(t, c, "client", tt.waiting)
+
+			if tt.release > 0 {
+				time.AfterFunc(tt.release, releases[0])
+				releases = releases[1:]
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.ctxAfter > 0 {
+				time.AfterFunc(tt.ctxAfter, cancel)
+			}
+
+			release, err := c.Acquire(ctx, "client", tt.limit)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if err == nil {
+				releases = append(releases, release)
+			}
+
+			for i := 0; i < tt.waiting; i++ {
+				if release := <-waiters; release != nil {
+					releases = append(releases, release)
+				}
+			}
+			for _, release := range releases {
+				release()
+			}
+			if n := len(c.clients); n != 0 {
+				t.Errorf("%d clients left after all requests finished", n)
+			}
+		})
+	}
+}
+
+// waitQueue ждет, пока в очереди клиента окажется n запросов
+func waitQueue(t *testing.T, c *ConcurrencyLimiter, clientID string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		c.mu.Lock()
+		queued := 0
+		if s, ok := c.clients[clientID]; ok {
+			queued = s.waiters.Len()
+		}
+		c.mu.Unlock()
+		if queued >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("queue length %d, want %d", queued, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestConcurrencyLimiterLimitChange(t *testing.T) {
+	c, err := NewConcurrencyLimiter(Concurrency{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		limit int
+		err   error
+	}{
+		{limit: 3},
+		{limit: 3},
+		// Лимит снижен до 1 при двух запросах в обработке
+		{limit: 1, err: ErrConcurrencyLimit},
+		// Повышение действует сразу
+		{limit: 4},
+		{limit: 4},
+		{limit: 4, err: ErrConcurrencyLimit},
+	}
+
+	var releases []func()
+	for i, tt := range tests {
+		release, err := c.Acquire(context.Background(), "client", tt.limit)
+		if !errors.Is(err, tt.err) {
+			t.Fatalf("request %d with limit %d: err = %v, want %v", i, tt.limit, err, tt.err)
+		}
+		if err == nil {
+			releases = append(releases, release)
+		}
+	}
+	for _, release := range releases {
+		release()
+	}
+	if _, err := c.Acquire(context.Background(), "other", 1); err != nil {
+		t.Errorf("other client: %v", err)
+	}
+}
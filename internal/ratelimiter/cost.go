@@ -0,0 +1,74 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// CostRule задает стоимость запроса в токенах. Правило подходит, если
+// совпали метод (пустой — любой) и префикс пути (пустой — любой). Header —
+// заголовок ответа бэкенда с фактической стоимостью: если она больше Cost,
+// разница списывается после ответа.
+//
+// Лимитер ограничивает стоимость емкостью бакета клиента: запрос дороже
+// емкости забирает весь бакет, то есть правило со стоимостью 50 для клиента
+// с емкостью 10 списывает 10 токенов.
+type CostRule struct {
+	Method     string
+	PathPrefix string
+	Cost       int
+	Header     string
+}
+
+// CostRules выбирает стоимость запроса по первому подходящему правилу
+type CostRules struct {
+	rules []CostRule
+}
+
+func NewCostRules(rules []CostRule) (*CostRules, error) {
+	c := &CostRules{rules: make([]CostRule, 0, len(rules))}
+	for _, rule := range rules {
+		if rule.Cost < 0 {
+			return nil, fmt.Errorf("cost rule %s %s: cost cannot be negative", rule.Method, rule.PathPrefix)
+		}
+		if rule.Cost == 0 {
+			rule.Cost = 1
+		}
+		rule.Method = strings.ToUpper(rule.Method)
+		if rule.Header != "" {
+			rule.Header = http.CanonicalHeaderKey(rule.Header)
+		}
+		c.rules = append(c.rules, rule)
+	}
+	return c, nil
+}
+
+// Match возвращает правило для запроса; если ни одно не подошло, запрос
+// стоит один токен
+func (c *CostRules) Match(r *http.Request) CostRule {
+	for _, rule := range c.rules {
+		if rule.Method != "" && rule.Method != r.Method {
+			continue
+		}
+		if !strings.HasPrefix(r.URL.Path, rule.PathPrefix) {
+			continue
+		}
+		return rule
+	}
+	return CostRule{Cost: 1}
+}
+
+// Extra возвращает стоимость сверх уже списанной по заголовку ответа
+// бэкенда. Неверное или меньшее значение заголовка ничего не добавляет.
+func (rule CostRule) Extra(header http.Header) int {
+	if rule.Header == "" {
+		return 0
+	}
+	actual, err := strconv.Atoi(header.Get(rule.Header))
+	if err != nil || actual <= rule.Cost {
+		return 0
+	}
+	return actual - rule.Cost
+}
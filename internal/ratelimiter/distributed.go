@@ -0,0 +1,166 @@
+package ratelimiter
+
+import (
+	"context"
+	"log"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"loadbalancer/internal/metrics"
+)
+
+// Что делать, если общее хранилище недоступно
+const (
+	FailLocal  = "local"  // перейти на лимиты каждой реплики по отдельности
+	FailOpen   = "open"   // пропускать все запросы
+	FailClosed = "closed" // отклонять все запросы
+)
+
+// Distributed — настройки общего для реплик лимита. В распределенном режиме
+// запросы считаются счетчиком скользящего окна в Store, а лимитер клиента
+// используется только при недоступности хранилища с политикой FailLocal.
+type Distributed struct {
+	Store      Store
+	FailPolicy string
+	Timeout    time.Duration // таймаут одного обращения к хранилищу
+}
+
+// storeFailing — хранилище недоступно; в лог пишется только смена состояния
+var storeFailing atomic.Bool
+
+// DistributedLimiter соблюдает один лимит клиента на все реплики
+type DistributedLimiter struct {
+	key      string
+	settings Distributed
+	local    Limiter
+
+	capacity int
+	window   time.Duration
+	mu       sync.Mutex
+}
+
+func newDistributedLimiter(clientID string, settings Distributed, local Limiter, limits Limits) *DistributedLimiter {
+	return &DistributedLimiter{
+		key:      "ratelimit:" + clientID,
+		settings: settings,
+		local:    local,
+		capacity: limits.Capacity,
+		window:   windowFor(limits.Capacity, limits.RatePerSec, limits.RefillPeriod),
+	}
+}
+
+func (d *DistributedLimiter) Take(cost int) Result {
+	return d.take(cost, true)
+}
+
+// Peek читает общие счетчики, прибавляя к ним 0
+func (d *DistributedLimiter) Peek(cost int) Result {
+	return d.take(cost, false)
+}
+
+func (d *DistributedLimiter) take(cost int, consume bool) Result {
+	d.mu.Lock()
+	capacity, window := d.capacity, d.window
+	d.mu.Unlock()
+
+	now := time.Now()
+	start := now.Truncate(window)
+	next := int64(clampCost(cost, capacity))
+	var added int64
+	if consume {
+		added = next
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.settings.Timeout)
+	defer cancel()
+	current, previous, err := d.settings.Store.Add(ctx, d.key, start, window, added)
+	if err != nil {
+		return d.fallback(capacity, cost, consume, err)
+	}
+	if storeFailing.CompareAndSwap(true, false) {
+		log.Printf("Rate limit store recovered")
+	}
+
+	elapsed := now.Sub(start)
+	weight := 1 - float64(elapsed)/float64(window)
+	estimate := float64(previous)*weight + float64(current)
+
+	result := Result{Limit: capacity, Window: window}
+	if estimate-float64(added)+float64(next) <= float64(capacity) {
+		result.Allowed = true
+		if consume {
+			next = 1
+		}
+	} else if consume {
+		// Отклоненный запрос не должен расходовать квоту
+		if _, _, err := d.settings.Store.Add(ctx, d.key, start, window, -next); err == nil {
+			current -= next
+			estimate -= float64(next)
+		}
+	}
+
+	result.Remaining = int(math.Floor(float64(capacity) - estimate))
+	if result.Remaining < 0 {
+		result.Remaining = 0
+	}
+	if estimate+float64(next) > float64(capacity) {
+		result.RetryAfter = slidingUntil(elapsed, window, float64(previous), float64(current), float64(int64(capacity)-next))
+	}
+	result.Reset = slidingUntil(elapsed, window, float64(previous), float64(current), 0)
+	return result
+}
+
+func (d *DistributedLimiter) fallback(capacity, cost int, consume bool, err error) Result {
+	d.storeFailed(err)
+
+	switch d.settings.FailPolicy {
+	case FailOpen:
+		return Result{Allowed: true, Limit: capacity, Remaining: capacity}
+	case FailClosed:
+		return Result{Limit: capacity, RetryAfter: time.Second}
+	default:
+		if !consume {
+			return d.local.Peek(cost)
+		}
+		return d.local.Take(cost)
+	}
+}
+
+func (d *DistributedLimiter) storeFailed(err error) {
+	metrics.RateLimitStoreErrors.With().Inc()
+	if storeFailing.CompareAndSwap(false, true) {
+		log.Printf("Rate limit store unavailable, falling back to %s policy: %v", d.settings.FailPolicy, err)
+	}
+}
+
+// Debit добавляет cost к общему счетчику окна. Если хранилище недоступно,
+// стоимость списывается с локального лимитера.
+func (d *DistributedLimiter) Debit(cost int) {
+	d.mu.Lock()
+	window := d.window
+	d.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.settings.Timeout)
+	defer cancel()
+	if _, _, err := d.settings.Store.Add(ctx, d.key, time.Now().Truncate(window), window, int64(cost)); err != nil {
+		d.storeFailed(err)
+		d.local.Debit(cost)
+	}
+}
+
+func (d *DistributedLimiter) Resize(capacity, refillRate int, refillPeriod time.Duration) {
+	d.mu.Lock()
+	d.capacity = capacity
+	d.window = windowFor(capacity, refillRate, refillPeriod)
+	d.mu.Unlock()
+
+	d.local.Resize(capacity, refillRate, refillPeriod)
+}
+
+// Algorithm — алгоритм локального лимитера, по которому сравниваются лимиты
+// при изменении клиента
+func (d *DistributedLimiter) Algorithm() string {
+	return d.local.Algorithm()
+}
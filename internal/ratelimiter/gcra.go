@@ -0,0 +1,103 @@
+package ratelimiter
+
+import (
+	"sync"
+	"time"
+)
+
+// GCRA — generic cell rate algorithm. Вместо счетчика токенов хранится одно
+// значение — теоретическое время прибытия (TAT) следующего запроса. Запрос
+// пропускается, если TAT опережает текущее время не больше чем на емкость.
+type GCRA struct {
+	capacity int
+	interval time.Duration // интервал между запросами при средней скорости
+	tat      time.Time
+	mu       sync.Mutex
+}
+
+func NewGCRA(capacity, refillRate int, refillPeriod time.Duration) *GCRA {
+	return &GCRA{
+		capacity: capacity,
+		interval: refillPeriod / time.Duration(refillRate),
+	}
+}
+
+// Take пропускает запрос стоимостью cost, сдвигая TAT на cost интервалов
+func (g *GCRA) Take(cost int) Result {
+	return g.take(cost, true)
+}
+
+func (g *GCRA) Peek(cost int) Result {
+	return g.take(cost, false)
+}
+
+func (g *GCRA) take(cost int, consume bool) Result {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	tat := g.tat
+	if tat.Before(now) {
+		tat = now
+	}
+
+	limit := g.interval * time.Duration(g.capacity)
+	result := Result{Limit: g.capacity, Window: limit}
+
+	next := tat.Add(g.interval * time.Duration(clampCost(cost, g.capacity)))
+	if allowAt := next.Add(-limit); now.Before(allowAt) {
+		result.RetryAfter = allowAt.Sub(now)
+	} else {
+		if consume {
+			g.tat = next
+			tat = next
+		}
+		result.Allowed = true
+	}
+
+	// Время, на которое TAT опережает текущее, — израсходованная часть квоты
+	used := tat.Sub(now)
+	result.Reset = used
+	result.Remaining = g.capacity - int((used+g.interval-1)/g.interval)
+	if result.Remaining < 0 {
+		result.Remaining = 0
+	}
+	if result.Remaining == 0 && result.RetryAfter == 0 {
+		result.RetryAfter = used - limit + g.interval
+	}
+	return result
+}
+
+func (g *GCRA) Debit(cost int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	if g.tat.Before(now) {
+		g.tat = now
+	}
+	g.tat = g.tat.Add(g.interval * time.Duration(cost))
+	// Долг не больше емкости: TAT опережает время не больше чем на два окна
+	if latest := now.Add(2 * g.interval * time.Duration(g.capacity)); g.tat.After(latest) {
+		g.tat = latest
+	}
+}
+
+func (g *GCRA) Resize(capacity, refillRate int, refillPeriod time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	oldLimit := g.interval * time.Duration(g.capacity)
+	g.capacity = capacity
+	g.interval = refillPeriod / time.Duration(refillRate)
+
+	if used := g.tat.Sub(now); used > 0 && oldLimit > 0 {
+		newLimit := g.interval * time.Duration(g.capacity)
+		g.tat = now.Add(time.Duration(float64(used) * float64(newLimit) / float64(oldLimit)))
+	}
+}
+
+func (g *GCRA) Algorithm() string {
+	return AlgorithmGCRA
+}
@@ -0,0 +1,226 @@
+package ratelimiter
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	util "loadbalancer/pkg/httputil"
+)
+
+// Источники идентификатора клиента
+const (
+	IdentityIP     = "ip"
+	IdentityHeader = "header"
+	IdentityQuery  = "query"
+	IdentityCookie = "cookie"
+	IdentityJWT    = "jwt"
+)
+
+// Политики для запросов, клиента которых не удалось определить
+const (
+	AnonymousShared = "shared" // общий бакет по умолчанию для всех анонимных запросов
+	AnonymousDeny   = "deny"   // отклонять
+	AnonymousAllow  = "allow"  // пропускать без ограничений
+)
+
+// AnonymousClientID — идентификатор, под которым учитываются анонимные запросы
+const AnonymousClientID = "anonymous"
+
+// IdentitySource описывает, откуда брать идентификатор клиента. Name — имя
+// заголовка, параметра запроса или cookie; для jwt — заголовок с токеном
+// (по умолчанию Authorization), Claim — поле токена (по умолчанию sub).
+type IdentitySource struct {
+	Type  string
+	Name  string
+	Claim string
+}
+
+// Identity — идентификатор клиента и тип источника, из которого он получен
+type Identity struct {
+	ID     string
+	Source string
+}
+
+type extractor struct {
+	source  string
+	extract func(r *http.Request) (string, bool)
+}
+
+// Identifier определяет клиента запроса, перебирая источники по порядку
+type Identifier struct {
+	extractors []extractor
+	anonymous  string
+}
+
+// NewIdentifier создает цепочку источников. jwtSecret — ключ HS256 для
+// проверки подписи токенов; без него источник jwt не принимается, иначе
+// любой мог бы назваться чужим клиентом.
+func NewIdentifier(sources []IdentitySource, anonymous, jwtSecret string) (*Identifier, error) {
+	if len(sources) == 0 {
+		sources = []IdentitySource{{Type: IdentityIP}}
+	}
+
+	id := &Identifier{anonymous: anonymous}
+	switch anonymous {
+	case "":
+		id.anonymous = AnonymousShared
+	case AnonymousShared, AnonymousDeny, AnonymousAllow:
+	default:
+		return nil, fmt.Errorf("unknown anonymous policy %q", anonymous)
+	}
+
+	for _, source := range sources {
+		extract, err := newExtractor(source, []byte(jwtSecret))
+		if err != nil {
+			return nil, err
+		}
+		id.extractors = append(id.extractors, extractor{source: source.Type, extract: extract})
+	}
+	return id, nil
+}
+
+// Identify возвращает идентификатор клиента из первого источника, который
+// смог его определить
+func (id *Identifier) Identify(r *http.Request) (Identity, bool) {
+	for _, ext := range id.extractors {
+		if clientID, ok := ext.extract(r); ok {
+			return Identity{ID: clientID, Source: ext.source}, true
+		}
+	}
+	return Identity{}, false
+}
+
+// FallbackID — под каким идентификатором учитывать клиента, назвавшегося
+// незарегистрированным ключом, заголовком или JWT: под его IP, а если IP не
+// определить — вместе с анонимными запросами. Иначе случайный ключ в каждом
+// запросе давал бы новый полный бакет.
+func FallbackID(r *http.Request) string {
+	if ip, ok := remoteIP(r); ok {
+		return ip
+	}
+	return AnonymousClientID
+}
+
+// AnonymousPolicy возвращает политику для запросов без идентификатора
+func (id *Identifier) AnonymousPolicy() string {
+	return id.anonymous
+}
+
+func newExtractor(source IdentitySource, jwtSecret []byte) (func(r *http.Request) (string, bool), error) {
+	switch source.Type {
+	case IdentityIP:
+		return remoteIP, nil
+	case IdentityHeader:
+		if source.Name == "" {
+			return nil, fmt.Errorf("identity source %q requires a name", source.Type)
+		}
+		return func(r *http.Request) (string, bool) {
+			v := r.Header.Get(source.Name)
+			return v, v != ""
+		}, nil
+	case IdentityQuery:
+		if source.Name == "" {
+			return nil, fmt.Errorf("identity source %q requires a name", source.Type)
+		}
+		return func(r *http.Request) (string, bool) {
+			v := r.URL.Query().Get(source.Name)
+			return v, v != ""
+		}, nil
+	case IdentityCookie:
+		if source.Name == "" {
+			return nil, fmt.Errorf("identity source %q requires a name", source.Type)
+		}
+		return func(r *http.Request) (string, bool) {
+			c, err := r.Cookie(source.Name)
+			if err != nil || c.Value == "" {
+				return "", false
+			}
+			return c.Value, true
+		}, nil
+	case IdentityJWT:
+		if len(jwtSecret) == 0 {
+			return nil, fmt.Errorf("identity source %q requires jwt_secret", source.Type)
+		}
+		header := source.Name
+		if header == "" {
+			header = "Authorization"
+		}
+		claim := source.Claim
+		if claim == "" {
+			claim = "sub"
+		}
+		return func(r *http.Request) (string, bool) {
+			token := r.Header.Get(header)
+			if t, ok := strings.CutPrefix(token, "Bearer "); ok {
+				token = t
+			}
+			return jwtClaim(token, claim, jwtSecret, time.Now())
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown identity source %q", source.Type)
+	}
+}
+
+// remoteIP — адрес клиента с учетом доверенных прокси
+func remoteIP(r *http.Request) (string, bool) {
+	ip := net.ParseIP(util.ClientIP(r))
+	if ip == nil {
+		return "", false
+	}
+	return ip.String(), true
+}
+
+// jwtClaim достает поле из JWT, подписанного HS256 ключом secret.
+// Просроченные токены (exp) не принимаются.
+func jwtClaim(token, claim string, secret []byte, now time.Time) (string, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", false
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || json.Unmarshal(raw, &header) != nil || header.Alg != "HS256" {
+		return "", false
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", false
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return "", false
+	}
+
+	raw, err = base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", false
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(raw, &claims); err != nil {
+		return "", false
+	}
+
+	if exp, ok := claims["exp"].(float64); ok && now.Unix() >= int64(exp) {
+		return "", false
+	}
+
+	switch v := claims[claim].(type) {
+	case string:
+		return v, v != ""
+	case float64:
+		return fmt.Sprint(v), true
+	default:
+		return "", false
+	}
+}
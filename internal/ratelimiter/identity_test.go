@@ -0,0 +1,227 @@
+package ratelimiter
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "test-secret"
+
+// signJWT собирает токен из готовых JSON заголовка и полей, подписывая его
+// HS256 ключом secret
+func signJWT(header, claims, secret string) string {
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString([]byte(header)) + "." + enc.EncodeToString([]byte(claims))
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + enc.EncodeToString(mac.Sum(nil))
+}
+
+func TestJWTClaim(t *testing.T) {
+	const hs256 = `{"alg":"HS256","typ":"JWT"}`
+	now := time.Unix(1700000000, 0)
+	valid := signJWT(hs256, `{"sub":"client-1"}`, testSecret)
+
+	tests := []struct {
+		name  string
+		token string
+		claim string
+		want  string
+		ok    bool
+	}{
+		{name: "subject", token: valid, claim: "sub", want: "client-1", ok: true},
+		{name: "custom claim", token: signJWT(hs256, `{"sub":"u","tenant":"acme"}`, testSecret), claim: "tenant", want: "acme", ok: true},
+		{name: "numeric claim", token: signJWT(hs256, `{"uid":42}`, testSecret), claim: "uid", want: "42", ok: true},
+		{name: "not yet expired", token: signJWT(hs256, `{"sub":"c","exp":1700000001}`, testSecret), claim: "sub", want: "c", ok: true},
+		{name: "expired", token: signJWT(hs256, `{"sub":"c","exp":1700000000}`, testSecret), claim: "sub"},
+		{name: "missing claim", token: valid, claim: "tenant"},
+		{name: "empty claim", token: signJWT(hs256, `{"sub":""}`, testSecret), claim: "sub"},
+		{name: "object claim", token: signJWT(hs256, `{"sub":{"id":1}}`, testSecret), claim: "sub"},
+		{name: "wrong secret", token: signJWT(hs256, `{"sub":"client-1"}`, "other"), claim: "sub"},
+		{name: "alg none", token: signJWT(`{"alg":"none"}`, `{"sub":"client-1"}`, testSecret), claim: "sub"},
+		{name: "alg HS512", token: signJWT(`{"alg":"HS512"}`, `{"sub":"client-1"}`, testSecret), claim: "sub"},
+		{name: "unsigned", token: unsign(valid), claim: "sub"},
+		{name: "tampered payload", token: tamper(valid), claim: "sub"},
+		{name: "two parts", token: "a.b", claim: "sub"},
+		{name: "bad base64", token: "!!.!!.!!", claim: "sub"},
+		{name: "payload is not JSON", token: signJWT(hs256, `client-1`, testSecret), claim: "sub"},
+		{name: "empty", token: "", claim: "sub"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := jwtClaim(tt.token, tt.claim, []byte(testSecret), now)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("jwtClaim = %q, %v; want %q, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+// tamper подменяет поля токена, сохраняя подпись
+func tamper(token string) string {
+	parts := strings.Split(token, ".")
+	return parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"admin"}`)) + "." + parts[2]
+}
+
+// unsign убирает подпись токена
+func unsign(token string) string {
+	return token[:strings.LastIndex(token, ".")+1]
+}
+
+func TestNewIdentifier(t *testing.T) {
+	tests := []struct {
+		name      string
+		sources   []IdentitySource
+		anonymous string
+		secret    string
+		policy    string
+		err       bool
+	}{
+		{name: "defaults", policy: AnonymousShared},
+		{name: "deny", anonymous: AnonymousDeny, policy: AnonymousDeny},
+		{name: "unknown policy", anonymous: "drop", err: true},
+		{name: "header needs name", sources: []IdentitySource{{Type: IdentityHeader}}, err: true},
+		{name: "query needs name", sources: []IdentitySource{{Type: IdentityQuery}}, err: true},
+		{name: "cookie needs name", sources: []IdentitySource{{Type: IdentityCookie}}, err: true},
+		{name: "jwt needs secret", sources: []IdentitySource{{Type: IdentityJWT}}, err: true},
+		{name: "jwt with secret", sources: []IdentitySource{{Type: IdentityJWT}}, secret: testSecret, policy: AnonymousShared},
+		{name: "unknown source", sources: []IdentitySource{{Type: "tls"}}, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := NewIdentifier(tt.sources, tt.anonymous, tt.secret)
+			if (err != nil) != tt.err {
+				t.Fatalf("err = %v, want error %v", err, tt.err)
+			}
+			if err == nil && id.AnonymousPolicy() != tt.policy {
+				t.Errorf("AnonymousPolicy = %q, want %q", id.AnonymousPolicy(), tt.policy)
+			}
+		})
+	}
+}
+
+func TestIdentify(t *testing.T) {
+	sources := []IdentitySource{
+		{Type: IdentityJWT, Name: "X-Token", Claim: "tenant"},
+		{Type: IdentityJWT},
+		{Type: IdentityHeader, Name: "X-API-Key"},
+		{Type: IdentityQuery, Name: "api_key"},
+		{Type: IdentityCookie, Name: "session"},
+	}
+	tenant := signJWT(`{"alg":"HS256"}`, `{"sub":"user","tenant":"acme"}`, testSecret)
+	user := signJWT(`{"alg":"HS256"}`, `{"sub":"user"}`, testSecret)
+	forged := signJWT(`{"alg":"HS256"}`, `{"sub":"user"}`, "guess")
+
+	tests := []struct {
+		name    string
+		target  string
+		headers map[string]string
+		cookie  string
+		want    Identity
+		ok      bool
+	}{
+		{
+			name:    "jwt in custom header with custom claim",
+			headers: map[string]string{"X-Token": tenant, "X-API-Key": "key"},
+			want:    Identity{ID: "acme", Source: IdentityJWT},
+			ok:      true,
+		},
+		{
+			name:    "bearer token",
+			headers: map[string]string{"Authorization": "Bearer " + user},
+			want:    Identity{ID: "user", Source: IdentityJWT},
+			ok:      true,
+		},
+		{
+			name:    "token without bearer prefix",
+			headers: map[string]string{"Authorization": user},
+			want:    Identity{ID: "user", Source: IdentityJWT},
+			ok:      true,
+		},
+		{
+			name:    "forged token falls through to the next source",
+			headers: map[string]string{"Authorization": "Bearer " + forged, "X-API-Key": "key"},
+			want:    Identity{ID: "key", Source: IdentityHeader},
+			ok:      true,
+		},
+		{
+			name:   "query parameter",
+			target: "/?api_key=q",
+			want:   Identity{ID: "q", Source: IdentityQuery},
+			ok:     true,
+		},
+		{
+			name:   "cookie",
+			cookie: "s1",
+			want:   Identity{ID: "s1", Source: IdentityCookie},
+			ok:     true,
+		},
+		{
+			name:    "empty values are skipped",
+			target:  "/?api_key=",
+			headers: map[string]string{"X-API-Key": ""},
+		},
+		{name: "anonymous"},
+	}
+
+	id, err := NewIdentifier(sources, AnonymousDeny, testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := tt.target
+			if target == "" {
+				target = "/"
+			}
+			r := httptest.NewRequest(http.MethodGet, target, nil)
+			for key, value := range tt.headers {
+				r.Header.Set(key, value)
+			}
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: "session", Value: tt.cookie})
+			}
+
+			got, ok := id.Identify(r)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("Identify = %+v, %v; want %+v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestIdentifyIP(t *testing.T) {
+	id, err := NewIdentifier(nil, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		remote string
+		want   string
+		ok     bool
+	}{
+		{remote: "203.0.113.5:4000", want: "203.0.113.5", ok: true},
+		{remote: "[2001:db8::1]:80", want: "2001:db8::1", ok: true},
+		{remote: "pipe"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tt.remote
+		got, ok := id.Identify(r)
+		if ok != tt.ok || got.ID != tt.want {
+			t.Errorf("Identify(%q) = %+v, %v; want %q, %v", tt.remote, got, ok, tt.want, tt.ok)
+		}
+		if fallback := FallbackID(r); tt.ok && fallback != tt.want || !tt.ok && fallback != AnonymousClientID {
+			t.Errorf("FallbackID(%q) = %q", tt.remote, fallback)
+		}
+	}
+}
@@ -1,15 +1,102 @@
 package ratelimiter
+
 // Реализация Token Bucket
 
 import (
+	"fmt"
+	"math"
 	"sync"
 	"time"
+
+	"loadbalancer/internal/domain"
+)
+
+// Алгоритмы ограничения частоты
+const (
+	AlgorithmTokenBucket   = "token_bucket"
+	AlgorithmGCRA          = "gcra"
+	AlgorithmSlidingLog    = "sliding_log"
+	AlgorithmSlidingWindow = "sliding_window"
 )
 
+// Limiter ограничивает частоту запросов одного клиента
+type Limiter interface {
+	// Take пытается пропустить запрос стоимостью cost токенов и возвращает
+	// состояние лимитера
+	Take(cost int) Result
+	// Peek возвращает состояние лимитера, как Take, но ничего не списывает
+	Peek(cost int) Result
+	// Debit списывает cost токенов без проверки — так учитывается стоимость,
+	// ставшая известной только после ответа. Долг не превышает емкости и
+	// задерживает следующие запросы.
+	Debit(cost int)
+	// Resize меняет лимиты на лету, сохраняя долю израсходованной квоты
+	Resize(capacity, refillRate int, refillPeriod time.Duration)
+	Algorithm() string
+}
+
+// Limits — параметры лимитера: Capacity запросов всплеском и RatePerSec
+// запросов за RefillPeriod в среднем. Оконные алгоритмы пропускают Capacity
+// запросов за окно Capacity/RatePerSec*RefillPeriod — с той же средней
+// скоростью и тем же максимальным всплеском.
+type Limits struct {
+	Algorithm    string
+	Capacity     int
+	RatePerSec   int
+	RefillPeriod time.Duration
+}
+
+// KnownAlgorithm сообщает, поддерживается ли алгоритм. Пустое имя означает
+// алгоритм по умолчанию.
+func KnownAlgorithm(name string) bool {
+	switch name {
+	case "", AlgorithmTokenBucket, AlgorithmGCRA, AlgorithmSlidingLog, AlgorithmSlidingWindow:
+		return true
+	}
+	return false
+}
+
+// NewLimiter создает лимитер по имени алгоритма; пустое имя — token bucket
+func NewLimiter(limits Limits) (Limiter, error) {
+	if limits.Capacity <= 0 || limits.RatePerSec <= 0 || limits.RefillPeriod <= 0 {
+		return nil, fmt.Errorf("invalid rate limit: capacity %d, rate %d per %s",
+			limits.Capacity, limits.RatePerSec, limits.RefillPeriod)
+	}
+	switch limits.Algorithm {
+	case "", AlgorithmTokenBucket:
+		return NewTokenBucket(limits.Capacity, limits.RatePerSec, limits.RefillPeriod), nil
+	case AlgorithmGCRA:
+		return NewGCRA(limits.Capacity, limits.RatePerSec, limits.RefillPeriod), nil
+	case AlgorithmSlidingLog:
+		return NewSlidingLog(limits.Capacity, limits.RatePerSec, limits.RefillPeriod), nil
+	case AlgorithmSlidingWindow:
+		return NewSlidingWindow(limits.Capacity, limits.RatePerSec, limits.RefillPeriod), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit algorithm %q", limits.Algorithm)
+	}
+}
+
+// clampCost приводит стоимость запроса к [1, capacity]: запрос дороже
+// емкости иначе не прошел бы никогда, поэтому он забирает весь бакет
+func clampCost(cost, capacity int) int {
+	if cost < 1 {
+		return 1
+	}
+	if cost > capacity {
+		return capacity
+	}
+	return cost
+}
+
+// windowFor — окно, за которое при заданной скорости набирается capacity запросов
+func windowFor(capacity, refillRate int, refillPeriod time.Duration) time.Duration {
+	return time.Duration(float64(refillPeriod) * float64(capacity) / float64(refillRate))
+}
+
 // TokenBucket представляет отдельный токен-бакет для клиента.
 type TokenBucket struct {
 	capacity     int
-	tokens       int
+	tokens       float64
 	refillRate   int           // сколько токенов добавляется за интервал
 	refillPeriod time.Duration // интервал пополнения
 	lastRefill   time.Time
@@ -20,35 +107,117 @@ type TokenBucket struct {
 func NewTokenBucket(capacity, refillRate int, refillPeriod time.Duration) *TokenBucket {
 	return &TokenBucket{
 		capacity:     capacity,
-		tokens:       capacity,
+		tokens:       float64(capacity),
 		refillRate:   refillRate,
 		refillPeriod: refillPeriod,
 		lastRefill:   time.Now(),
 	}
 }
 
-// Allow пытается получить токен. Возвращает true, если успешно.
-func (b *TokenBucket) Allow() bool {
+// Result — решение лимитера и состояние бакета после него
+type Result struct {
+	Allowed    bool
+	Limit      int           // емкость бакета
+	Remaining  int           // токены, оставшиеся после запроса
+	RetryAfter time.Duration // через сколько пройдет запрос той же стоимости (после успешного — стоимостью 1); 0, если пройдет сразу
+	Reset      time.Duration // через сколько бакет заполнится полностью
+	Window     time.Duration // за сколько пустой бакет заполняется полностью
+	// Quota — расход долгосрочной квоты клиента; nil, если квоты нет.
+	// Если запрос отклонен квотой, поля бакета не заполнены.
+	Quota *domain.QuotaReport
+}
+
+// Take пытается получить cost токенов и возвращает состояние бакета
+func (b *TokenBucket) Take(cost int) Result {
+	return b.take(cost, true)
+}
+
+func (b *TokenBucket) Peek(cost int) Result {
+	return b.take(cost, false)
+}
+
+// take проверяет, хватает ли cost токенов, и при consume списывает их
+func (b *TokenBucket) take(cost int, consume bool) Result {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	now := time.Now()
-	elapsed := now.Sub(b.lastRefill)
+	b.refill(time.Now())
 
-	// Пополняем токены, если прошло достаточно времени
-	if elapsed >= b.refillPeriod {
-		refills := int(elapsed / b.refillPeriod)
-		b.tokens += refills * b.refillRate
-		if b.tokens > b.capacity {
-			b.tokens = b.capacity
+	need := float64(clampCost(cost, b.capacity))
+	allowed := false
+	if b.tokens >= need {
+		if consume {
+			b.tokens -= need
+			need = 1
 		}
-		b.lastRefill = now
+		allowed = true
 	}
 
-	if b.tokens > 0 {
-		b.tokens--
-		return true
+	result := Result{
+		Allowed:   allowed,
+		Limit:     b.capacity,
+		Remaining: int(math.Max(b.tokens, 0)),
+		Reset:     b.untilRefilled(float64(b.capacity) - b.tokens),
+		Window:    b.untilRefilled(float64(b.capacity)),
+	}
+	if b.tokens < need {
+		result.RetryAfter = b.untilRefilled(need - b.tokens)
 	}
+	return result
+}
 
-	return false
-}
\ No newline at end of file
+func (b *TokenBucket) Debit(cost int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(time.Now())
+	b.tokens = math.Max(b.tokens-float64(cost), -float64(b.capacity))
+}
+
+// Resize меняет лимиты бакета на лету. Текущий остаток токенов сохраняется
+// пропорционально: бакет, заполненный наполовину, остается заполненным
+// наполовину и при новой емкости.
+func (b *TokenBucket) Resize(capacity, refillRate int, refillPeriod time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Токены, накопленные до изменения, начисляются по старой скорости
+	b.refill(time.Now())
+
+	if b.capacity > 0 {
+		b.tokens = b.tokens * float64(capacity) / float64(b.capacity)
+	} else {
+		b.tokens = float64(capacity)
+	}
+	b.capacity = capacity
+	b.refillRate = refillRate
+	b.refillPeriod = refillPeriod
+}
+
+func (b *TokenBucket) Algorithm() string {
+	return AlgorithmTokenBucket
+}
+
+// refill непрерывно пополняет токены пропорционально прошедшему времени,
+// без ожидания целого интервала. Вызывается под b.mu.
+func (b *TokenBucket) refill(now time.Time) {
+	elapsed := now.Sub(b.lastRefill)
+	if elapsed <= 0 {
+		return
+	}
+	if b.refillPeriod > 0 {
+		b.tokens += float64(elapsed) / float64(b.refillPeriod) * float64(b.refillRate)
+	}
+	if b.tokens > float64(b.capacity) {
+		b.tokens = float64(b.capacity)
+	}
+	b.lastRefill = now
+}
+
+// untilRefilled — время, за которое добавится tokens токенов. Вызывается под b.mu.
+func (b *TokenBucket) untilRefilled(tokens float64) time.Duration {
+	if b.refillRate <= 0 || tokens <= 0 {
+		return 0
+	}
+	return time.Duration(tokens / float64(b.refillRate) * float64(b.refillPeriod))
+}
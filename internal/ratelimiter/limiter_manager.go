@@ -1,29 +1,268 @@
 package ratelimiter
 
 import (
-	"net"
+	"container/list"
+	"context"
+	"fmt"
+	"log"
 	"sync"
 	"time"
 
+	"loadbalancer/internal/domain"
 	"loadbalancer/internal/interfaces/repositories"
+	"loadbalancer/internal/metrics"
 )
 
+// Eviction ограничивает бакеты незарегистрированных клиентов: бакет
+// удаляется, если клиент не обращался дольше IdleTTL, а при превышении
+// MaxBuckets удаляется бакет, который дольше всех не использовался.
+// Нулевые значения отключают соответствующее ограничение.
+type Eviction struct {
+	IdleTTL    time.Duration
+	MaxBuckets int
+}
+
+// defaultEntry — бакет по умолчанию для незарегистрированного клиента
+type defaultEntry struct {
+	clientID string
+	bucket   Limiter
+	lastSeen time.Time
+}
+
 type LimiterManager struct {
-	buckets        map[string]*TokenBucket
-	mu             sync.Mutex
-	clientRepo     repositories.ClientRepository
-	defaultLimiter *TokenBucket
+	buckets    map[string]Limiter
+	defaults   map[string]*list.Element
+	lru        *list.List // в начале — недавно использованные бакеты по умолчанию
+	mu         sync.Mutex
+	clientRepo repositories.ClientRepository
+	planRepo   repositories.PlanRepository
+
+	defaultLimits Limits
+	eviction      Eviction
+	distributed   *Distributed // nil — каждая реплика считает лимиты сама
+	concurrency   *ConcurrencyLimiter
+	quotas        *QuotaTracker
+	stop          chan struct{}
+	done          chan struct{}
+}
+
+// NewLimiterManager создает менеджер лимитеров. defaultLimits применяются
+// к незарегистрированным клиентам, а их алгоритм — еще и к клиентам, для
+// которых алгоритм не задан ни в клиенте, ни в его плане. distributed
+// включает общий для реплик лимит. Расход квот сохраняется в репозиторий
+// раз в quotaFlush и при Close.
+func NewLimiterManager(clientRepo repositories.ClientRepository, planRepo repositories.PlanRepository, defaultLimits Limits, eviction Eviction, distributed *Distributed, concurrency Concurrency, quotaFlush time.Duration) (*LimiterManager, error) {
+	if distributed != nil && defaultLimits.Algorithm != "" && defaultLimits.Algorithm != AlgorithmSlidingWindow {
+		log.Printf("Rate limit algorithm %s applies only when the shared store is unavailable: replicas count requests by %s",
+			defaultLimits.Algorithm, AlgorithmSlidingWindow)
+	}
+	if defaultLimits.Algorithm == "" {
+		defaultLimits.Algorithm = AlgorithmTokenBucket
+	}
+	if _, err := NewLimiter(defaultLimits); err != nil {
+		return nil, fmt.Errorf("default rate limit: %w", err)
+	}
+	if distributed != nil {
+		switch distributed.FailPolicy {
+		case "":
+			distributed.FailPolicy = FailLocal
+		case FailLocal, FailOpen, FailClosed:
+		default:
+			return nil, fmt.Errorf("unknown rate limit fail policy %q", distributed.FailPolicy)
+		}
+		if distributed.Timeout <= 0 {
+			distributed.Timeout = 50 * time.Millisecond
+		}
+	}
+
+	concurrencyLimiter, err := NewConcurrencyLimiter(concurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &LimiterManager{
+		buckets:       make(map[string]Limiter),
+		defaults:      make(map[string]*list.Element),
+		lru:           list.New(),
+		clientRepo:    clientRepo,
+		planRepo:      planRepo,
+		defaultLimits: defaultLimits,
+		eviction:      eviction,
+		distributed:   distributed,
+		concurrency:   concurrencyLimiter,
+		quotas:        NewQuotaTracker(clientRepo),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	m.reportBuckets()
+
+	clientRepo.Subscribe(m.onClientChange)
+	planRepo.Subscribe(m.onPlanChange)
+	go m.flushQuotas(quotaFlush)
+	return m, nil
+}
+
+// flushQuotas периодически сохраняет расход квот
+func (m *LimiterManager) flushQuotas(interval time.Duration) {
+	defer close(m.done)
+	if interval <= 0 {
+		<-m.stop
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.quotas.Flush()
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// Close останавливает фоновое сохранение и сохраняет расход квот
+func (m *LimiterManager) Close() {
+	close(m.stop)
+	<-m.done
+	m.quotas.Flush()
+}
+
+// CheckAlgorithm проверяет алгоритм клиента или плана. С общим для реплик
+// хранилищем запросы считаются скользящим окном, поэтому другой алгоритм
+// задать нельзя: он молча не действовал бы.
+func (m *LimiterManager) CheckAlgorithm(name string) error {
+	if !KnownAlgorithm(name) {
+		return fmt.Errorf("unknown rate limit algorithm %q", name)
+	}
+	if m.distributed != nil && name != "" && name != AlgorithmSlidingWindow {
+		return fmt.Errorf("rate limit algorithm %q is not available with a distributed store: replicas count requests by %s",
+			name, AlgorithmSlidingWindow)
+	}
+	return nil
+}
+
+// Registered сообщает, зарегистрирован ли клиент
+func (m *LimiterManager) Registered(clientID string) bool {
+	_, err := m.clientRepo.FindByID(clientID)
+	return err == nil
+}
+
+// findClient возвращает зарегистрированного клиента с учетом его плана
+func (m *LimiterManager) findClient(clientID string) (*domain.Client, error) {
+	client, err := m.clientRepo.FindByID(clientID)
+	if err != nil {
+		return nil, err
+	}
+	return m.withPlan(client), nil
+}
+
+// withPlan заполняет незаданные поля клиента из его плана. Если плана нет
+// в репозитории, действуют только собственные поля клиента.
+func (m *LimiterManager) withPlan(client *domain.Client) *domain.Client {
+	if client.Plan == "" {
+		return client
+	}
+	plan, err := m.planRepo.FindByName(client.Plan)
+	if err != nil {
+		log.Printf("Rate limiter: client %s: plan %s: %v", client.ID, client.Plan, err)
+		return client
+	}
+	return client.WithPlan(plan)
+}
+
+// limitsFor возвращает параметры лимитера зарегистрированного клиента
+func (m *LimiterManager) limitsFor(client *domain.Client) Limits {
+	limits := Limits{
+		Algorithm:    client.Algorithm,
+		Capacity:     client.Capacity,
+		RatePerSec:   client.RatePerSec,
+		RefillPeriod: client.RefillPeriod,
+	}
+	if limits.Algorithm == "" {
+		limits.Algorithm = m.defaultLimits.Algorithm
+	}
+	return limits
+}
+
+// newLimiter создает лимитер клиента, в распределенном режиме — общий для реплик
+func (m *LimiterManager) newLimiter(clientID string, limits Limits) (Limiter, error) {
+	limiter, err := NewLimiter(limits)
+	if err != nil || m.distributed == nil {
+		return limiter, err
+	}
+	return newDistributedLimiter(clientID, *m.distributed, limiter, limits), nil
+}
+
+// onClientChange применяет изменения клиента к уже созданным бакетам:
+// обновление меняет лимиты на месте, удаление возвращает клиента к лимитам
+// по умолчанию
+func (m *LimiterManager) onClientChange(event domain.ClientEvent) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	client := event.Client
+	if event.Deleted {
+		m.quotas.Forget(client.ID)
+		forgetDecisions(client.ID)
+		delete(m.buckets, client.ID)
+		m.reportBuckets()
+		return
+	}
+
+	if _, exists := m.buckets[client.ID]; exists {
+		m.applyLimits(m.withPlan(&client))
+		return
+	}
+	// Клиент только что зарегистрирован: следующий запрос создаст бакет с его лимитами
+	if el, exists := m.defaults[client.ID]; exists {
+		m.removeDefault(el)
+		m.reportBuckets()
+	}
+}
+
+// onPlanChange применяет изменение плана ко всем его клиентам
+func (m *LimiterManager) onPlanChange(event domain.PlanEvent) {
+	clients, err := m.clientRepo.FindAll()
+	if err != nil {
+		log.Printf("Rate limiter: plan %s: %v", event.Plan.Name, err)
+		return
+	}
+
+	var affected []*domain.Client
+	for _, client := range clients {
+		if client.Plan == event.Plan.Name {
+			affected = append(affected, m.withPlan(client))
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, client := range affected {
+		m.applyLimits(client)
+	}
 }
 
-func NewLimiterManager(clientRepo repositories.ClientRepository, defaultCapacity, defaultRefillRate int, refillPeriod time.Duration) *LimiterManager {
-	return &LimiterManager{
-		buckets:        make(map[string]*TokenBucket),
-		clientRepo:     clientRepo,
-		defaultLimiter: NewTokenBucket(defaultCapacity, defaultRefillRate, refillPeriod),
+// applyLimits меняет лимиты уже созданного бакета клиента на месте.
+// Вызывается под m.mu.
+func (m *LimiterManager) applyLimits(client *domain.Client) {
+	bucket, exists := m.buckets[client.ID]
+	if !exists {
+		return
 	}
+	limits := m.limitsFor(client)
+	if bucket.Algorithm() == limits.Algorithm && limits.Capacity > 0 && limits.RatePerSec > 0 {
+		bucket.Resize(limits.Capacity, limits.RatePerSec, limits.RefillPeriod)
+		return
+	}
+	// Состояние разных алгоритмов несовместимо, а неполные лимиты нельзя
+	// применить на месте: лимитер создается заново при следующем запросе
+	delete(m.buckets, client.ID)
+	m.reportBuckets()
 }
 
-func (m *LimiterManager) getOrCreateBucket(clientID string) (*TokenBucket, error) {
+func (m *LimiterManager) getOrCreateBucket(clientID string) (Limiter, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -32,22 +271,202 @@ func (m *LimiterManager) getOrCreateBucket(clientID string) (*TokenBucket, error
 	}
 
 	// попытка найти лимиты
-	client, err := m.clientRepo.FindByID(clientID)
+	client, err := m.findClient(clientID)
 	if err == nil {
-		bucket := NewTokenBucket(client.Capacity, client.RatePerSec, client.RefillPeriod)
+		bucket, err := m.newLimiter(clientID, m.limitsFor(client))
+		if err != nil {
+			return nil, fmt.Errorf("client %s: %w", clientID, err)
+		}
 		m.buckets[clientID] = bucket
+		m.reportBuckets()
 		return bucket, nil
 	}
 
-	
-	return m.defaultLimiter, nil
+	return m.defaultBucket(clientID, time.Now()), nil
+}
+
+// defaultBucket возвращает собственный бакет по умолчанию для
+// незарегистрированного клиента, чтобы один шумный клиент не расходовал
+// токены остальных. Незарегистрированные клиенты учитываются по IP (см.
+// FallbackID), поэтому число бакетов ограничено числом адресов. Вызывается
+// под m.mu.
+func (m *LimiterManager) defaultBucket(clientID string, now time.Time) Limiter {
+	m.evictIdle(now)
+
+	if el, exists := m.defaults[clientID]; exists {
+		entry := el.Value.(*defaultEntry)
+		entry.lastSeen = now
+		m.lru.MoveToFront(el)
+		return entry.bucket
+	}
+
+	// Лимиты по умолчанию проверены в NewLimiterManager
+	bucket, _ := m.newLimiter(clientID, m.defaultLimits)
+	entry := &defaultEntry{
+		clientID: clientID,
+		bucket:   bucket,
+		lastSeen: now,
+	}
+	m.defaults[clientID] = m.lru.PushFront(entry)
+	if m.eviction.MaxBuckets > 0 && m.lru.Len() > m.eviction.MaxBuckets {
+		m.removeDefault(m.lru.Back())
+	}
+	m.reportBuckets()
+	return entry.bucket
+}
+
+// evictIdle удаляет бакеты клиентов, которые не обращались дольше IdleTTL.
+// Список упорядочен по времени обращения, поэтому проверяется только хвост.
+func (m *LimiterManager) evictIdle(now time.Time) {
+	if m.eviction.IdleTTL <= 0 {
+		return
+	}
+	evicted := false
+	for el := m.lru.Back(); el != nil; el = m.lru.Back() {
+		if now.Sub(el.Value.(*defaultEntry).lastSeen) < m.eviction.IdleTTL {
+			break
+		}
+		m.removeDefault(el)
+		evicted = true
+	}
+	if evicted {
+		m.reportBuckets()
+	}
+}
+
+func (m *LimiterManager) removeDefault(el *list.Element) {
+	entry := m.lru.Remove(el).(*defaultEntry)
+	delete(m.defaults, entry.clientID)
+}
+
+// Решения rate-limiter-а для метрики lb_ratelimit_requests_total
+const (
+	decisionAllowed            = "allowed"
+	decisionDenied             = "denied"
+	decisionQuotaExceeded      = "quota_exceeded"
+	decisionConcurrencyLimited = "concurrency_limited"
+)
+
+// recordDecision учитывает решение в метрике. Отдельную серию получают
+// только зарегистрированные клиенты, остальные учитываются вместе как
+// "anonymous" или "default", чтобы число серий не росло с числом адресов.
+func (m *LimiterManager) recordDecision(clientID, decision string) {
+	label := clientID
+	if clientID != AnonymousClientID && !m.Registered(clientID) {
+		label = "default"
+	}
+	metrics.RateLimitDecisions.With(label, decision).Inc()
+}
+
+// forgetDecisions удаляет серии метрики удаленного клиента
+func forgetDecisions(clientID string) {
+	metrics.RateLimitDecisions.DeletePrefix(clientID)
+}
+
+// reportBuckets обновляет метрику числа бакетов. Вызывается под m.mu.
+func (m *LimiterManager) reportBuckets() {
+	metrics.RateLimitBuckets.With("client").Set(float64(len(m.buckets)))
+	metrics.RateLimitBuckets.With("default").Set(float64(len(m.defaults)))
+}
+
+// Allow списывает запрос из квоты и cost токенов из бакета клиента и
+// возвращает решение вместе с их состоянием для заголовков RateLimit-*.
+// Квота считает запросы, а не их стоимость.
+func (m *LimiterManager) Allow(clientID string, cost int) Result {
+	bucket, err := m.getOrCreateBucket(clientID)
+	if err != nil {
+		log.Printf("Rate limiter: %v", err)
+		m.recordDecision(clientID, decisionDenied)
+		return Result{}
+	}
+
+	var quota *domain.QuotaReport
+	taken := time.Now()
+	if client, err := m.findClient(clientID); err == nil && client.Quota.Limit > 0 {
+		report, allowed := m.quotas.Take(client, 1, taken)
+		if !allowed {
+			m.recordDecision(clientID, decisionQuotaExceeded)
+			return Result{RetryAfter: time.Until(report.ResetAt), Quota: &report}
+		}
+		quota = &report
+	}
+
+	result := bucket.Take(cost)
+	if !result.Allowed && quota != nil {
+		// Запрос, отклоненный бакетом, не расходует квоту
+		m.quotas.Refund(clientID, 1, taken)
+		quota.Used--
+		quota.Remaining++
+	}
+	result.Quota = quota
+	decision := decisionDenied
+	if result.Allowed {
+		decision = decisionAllowed
+	}
+	m.recordDecision(clientID, decision)
+	return result
 }
 
-func (m *LimiterManager) Allow(ip net.IP) bool {
-	clientID := ip.String()
+// Peek возвращает состояние бакета и квоты клиента для запроса стоимостью
+// cost, ничего не списывая
+func (m *LimiterManager) Peek(clientID string, cost int) Result {
 	bucket, err := m.getOrCreateBucket(clientID)
 	if err != nil {
-		return false
+		return Result{}
+	}
+
+	result := bucket.Peek(cost)
+	if client, err := m.findClient(clientID); err == nil && client.Quota.Limit > 0 {
+		report := m.quotas.Report(client)
+		result.Quota = &report
+		if report.Remaining <= 0 {
+			result.Allowed = false
+			if wait := time.Until(report.ResetAt); wait > result.RetryAfter {
+				result.RetryAfter = wait
+			}
+		}
+	}
+	return result
+}
+
+// Debit списывает с бакета клиента стоимость, ставшую известной после
+// ответа. Бакет не создается: он уже есть, если запрос был пропущен.
+func (m *LimiterManager) Debit(clientID string, cost int) {
+	if cost <= 0 {
+		return
+	}
+
+	m.mu.Lock()
+	bucket, exists := m.buckets[clientID]
+	if !exists {
+		if el, ok := m.defaults[clientID]; ok {
+			bucket, exists = el.Value.(*defaultEntry).bucket, true
+		}
+	}
+	m.mu.Unlock()
+
+	if exists {
+		bucket.Debit(cost)
+	}
+}
+
+// QuotaUsage возвращает текущий расход квоты клиента с учетом его плана
+func (m *LimiterManager) QuotaUsage(client *domain.Client) domain.QuotaReport {
+	return m.quotas.Report(m.withPlan(client))
+}
+
+// Acquire занимает место среди одновременных запросов клиента. Лимит берется
+// из записи клиента, для незарегистрированных — из настроек по умолчанию.
+// release нужно вызвать после отправки ответа.
+func (m *LimiterManager) Acquire(ctx context.Context, clientID string) (release func(), err error) {
+	limit := m.concurrency.settings.DefaultMax
+	if client, err := m.findClient(clientID); err == nil {
+		limit = client.MaxConcurrent
+	}
+
+	release, err = m.concurrency.Acquire(ctx, clientID, limit)
+	if err != nil {
+		m.recordDecision(clientID, decisionConcurrencyLimited)
 	}
-	return bucket.Allow()
-}
\ No newline at end of file
+	return release, err
+}
@@ -0,0 +1,342 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+)
+
+var algorithms = []string{AlgorithmTokenBucket, AlgorithmGCRA, AlgorithmSlidingLog, AlgorithmSlidingWindow}
+
+// Операции шага сценария
+const (
+	opTake  = "take"
+	opPeek  = "peek"
+	opDebit = "debit"
+	opAge   = "age"
+)
+
+// step — шаг сценария: операция над лимитером и ожидаемый результат.
+// retry < 0 — RetryAfter не проверяется.
+type step struct {
+	op        string
+	cost      int
+	age       time.Duration
+	allowed   bool
+	remaining int
+	retry     time.Duration
+}
+
+func take(cost int, allowed bool, remaining int) step {
+	return step{op: opTake, cost: cost, allowed: allowed, remaining: remaining, retry: -1}
+}
+
+func peek(cost int, allowed bool, remaining int) step {
+	return step{op: opPeek, cost: cost, allowed: allowed, remaining: remaining, retry: -1}
+}
+
+func debit(cost int) step {
+	return step{op: opDebit, cost: cost}
+}
+
+func age(d time.Duration) step {
+	return step{op: opAge, age: d}
+}
+
+// withRetry добавляет к шагу ожидаемый RetryAfter
+func (s step) withRetry(retry time.Duration) step {
+	s.retry = retry
+	return s
+}
+
+// retryTolerance покрывает время, прошедшее между шагами по реальным часам
+const retryTolerance = 50 * time.Millisecond
+
+// rewind сдвигает состояние лимитера в прошлое на d, как будто d прошло
+func rewind(t *testing.T, limiter Limiter, d time.Duration) {
+	t.Helper()
+	switch l := limiter.(type) {
+	case *TokenBucket:
+		l.lastRefill = l.lastRefill.Add(-d)
+	case *GCRA:
+		if !l.tat.IsZero() {
+			l.tat = l.tat.Add(-d)
+		}
+	case *SlidingLog:
+		for i := range l.log {
+			l.log[i] = l.log[i].Add(-d)
+		}
+	case *SlidingWindow:
+		l.start = l.start.Add(-d)
+	default:
+		t.Fatalf("rewind: unsupported limiter %T", limiter)
+	}
+}
+
+func run(t *testing.T, limiter Limiter, steps []step) {
+	t.Helper()
+	for i, s := range steps {
+		var result Result
+		switch s.op {
+		case opAge:
+			rewind(t, limiter, s.age)
+			continue
+		case opDebit:
+			limiter.Debit(s.cost)
+			continue
+		case opTake:
+			result = limiter.Take(s.cost)
+		case opPeek:
+			result = limiter.Peek(s.cost)
+		}
+
+		if result.Allowed != s.allowed {
+			t.Errorf("step %d %s(%d): allowed = %v, want %v", i, s.op, s.cost, result.Allowed, s.allowed)
+		}
+		if result.Remaining != s.remaining {
+			t.Errorf("step %d %s(%d): remaining = %d, want %d", i, s.op, s.cost, result.Remaining, s.remaining)
+		}
+		if s.retry >= 0 {
+			if diff := result.RetryAfter - s.retry; diff < -retryTolerance || diff > retryTolerance {
+				t.Errorf("step %d %s(%d): retry after = %s, want %s", i, s.op, s.cost, result.RetryAfter, s.retry)
+			}
+		}
+		if result.Limit <= 0 || result.Window <= 0 {
+			t.Errorf("step %d %s(%d): limit %d, window %s must be positive", i, s.op, s.cost, result.Limit, result.Window)
+		}
+	}
+}
+
+// TestLimiterBurst проверяет поведение, общее для всех алгоритмов, при
+// скорости настолько низкой, что за время теста ничего не восстанавливается
+func TestLimiterBurst(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "burst up to capacity",
+			steps: []step{
+				take(1, true, 4), take(1, true, 3), take(1, true, 2), take(1, true, 1), take(1, true, 0),
+				take(1, false, 0), take(1, false, 0),
+			},
+		},
+		{
+			name:  "cost takes several tokens",
+			steps: []step{take(3, true, 2), take(3, false, 2), take(2, true, 0)},
+		},
+		{
+			name:  "cost above capacity takes the whole bucket",
+			steps: []step{take(10, true, 0), take(1, false, 0)},
+		},
+		{
+			name:  "cost above capacity waits for the whole bucket",
+			steps: []step{take(1, true, 4), take(10, false, 4)},
+		},
+		{
+			name:  "cost below one counts as one",
+			steps: []step{take(0, true, 4), take(-3, true, 3)},
+		},
+		{
+			name: "peek does not consume",
+			steps: []step{
+				peek(5, true, 5), peek(6, true, 5), take(5, true, 0), peek(1, false, 0), peek(1, false, 0),
+			},
+		},
+		{
+			name:  "debit is taken without a check",
+			steps: []step{debit(3), take(1, true, 1), take(2, false, 1)},
+		},
+		{
+			name:  "debit beyond capacity turns into debt",
+			steps: []step{debit(7), peek(1, false, 0), take(1, false, 0)},
+		},
+	}
+
+	for _, algorithm := range algorithms {
+		for _, tt := range tests {
+			t.Run(algorithm+"/"+tt.name, func(t *testing.T) {
+				limiter, err := NewLimiter(Limits{Algorithm: algorithm, Capacity: 5, RatePerSec: 1, RefillPeriod: time.Hour})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if limiter.Algorithm() != algorithm {
+					t.Fatalf("Algorithm() = %q, want %q", limiter.Algorithm(), algorithm)
+				}
+				run(t, limiter, tt.steps)
+			})
+		}
+	}
+}
+
+// TestLimiterRefill проверяет восстановление и RetryAfter каждого алгоритма:
+// емкость 5, один запрос в секунду, окно 5 секунд
+func TestLimiterRefill(t *testing.T) {
+	tests := []struct {
+		algorithm string
+		name      string
+		steps     []step
+	}{
+		{
+			algorithm: AlgorithmTokenBucket,
+			name:      "tokens refill continuously",
+			steps: []step{
+				take(5, true, 0).withRetry(time.Second),
+				take(1, false, 0).withRetry(time.Second),
+				age(2 * time.Second),
+				take(1, true, 1).withRetry(0),
+				take(3, false, 1).withRetry(2 * time.Second),
+			},
+		},
+		{
+			algorithm: AlgorithmTokenBucket,
+			name:      "debt delays requests",
+			steps: []step{
+				take(5, true, 0), debit(100),
+				take(1, false, 0).withRetry(6 * time.Second),
+				age(6 * time.Second),
+				take(1, true, 0),
+			},
+		},
+		{
+			algorithm: AlgorithmTokenBucket,
+			name:      "full bucket does not overflow",
+			steps:     []step{age(time.Hour), take(5, true, 0), take(1, false, 0)},
+		},
+		{
+			algorithm: AlgorithmGCRA,
+			name:      "one request per interval after a burst",
+			steps: []step{
+				take(5, true, 0).withRetry(time.Second),
+				take(1, false, 0).withRetry(time.Second),
+				take(2, false, 0).withRetry(2 * time.Second),
+				age(time.Second),
+				take(1, true, 0).withRetry(time.Second),
+				age(3 * time.Second),
+				take(3, true, 0),
+			},
+		},
+		{
+			algorithm: AlgorithmGCRA,
+			name:      "debt is capped at capacity",
+			steps: []step{
+				debit(100),
+				take(1, false, 0).withRetry(6 * time.Second),
+				age(6 * time.Second),
+				take(1, true, 0),
+			},
+		},
+		{
+			algorithm: AlgorithmSlidingLog,
+			name:      "oldest requests leave the window",
+			steps: []step{
+				take(3, true, 2), age(2 * time.Second),
+				take(2, true, 0).withRetry(3 * time.Second),
+				take(1, false, 0).withRetry(3 * time.Second),
+				take(4, false, 0).withRetry(5 * time.Second),
+				age(3 * time.Second),
+				take(3, true, 0),
+				take(1, false, 0).withRetry(2 * time.Second),
+			},
+		},
+		{
+			algorithm: AlgorithmSlidingLog,
+			name:      "log is capped at two capacities",
+			steps: []step{
+				debit(100),
+				take(1, false, 0).withRetry(5 * time.Second),
+				age(5 * time.Second),
+				take(5, true, 0),
+			},
+		},
+		{
+			algorithm: AlgorithmSlidingWindow,
+			name:      "previous window weight decays",
+			steps: []step{
+				take(5, true, 0),
+				take(1, false, 0).withRetry(6 * time.Second),
+				age(5 * time.Second),
+				take(1, false, 0).withRetry(time.Second),
+				age(2500 * time.Millisecond),
+				take(2, true, 0),
+				take(1, false, 0),
+			},
+		},
+		{
+			algorithm: AlgorithmSlidingWindow,
+			name:      "idle for two windows resets",
+			steps: []step{
+				take(5, true, 0), age(10 * time.Second),
+				take(5, true, 0).withRetry(6 * time.Second),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.algorithm+"/"+tt.name, func(t *testing.T) {
+			limiter, err := NewLimiter(Limits{Algorithm: tt.algorithm, Capacity: 5, RatePerSec: 5, RefillPeriod: 5 * time.Second})
+			if err != nil {
+				t.Fatal(err)
+			}
+			run(t, limiter, tt.steps)
+		})
+	}
+}
+
+func TestLimiterResize(t *testing.T) {
+	tests := []struct {
+		algorithm string
+		remaining int
+	}{
+		// Израсходовано 2 из 5 — после увеличения до 10 израсходовано 4
+		{AlgorithmTokenBucket, 6},
+		{AlgorithmGCRA, 6},
+		{AlgorithmSlidingWindow, 6},
+		// Журнал при увеличении емкости сохраняется целиком
+		{AlgorithmSlidingLog, 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			limiter, err := NewLimiter(Limits{Algorithm: tt.algorithm, Capacity: 5, RatePerSec: 1, RefillPeriod: time.Hour})
+			if err != nil {
+				t.Fatal(err)
+			}
+			limiter.Take(2)
+			limiter.Resize(10, 2, time.Hour)
+			run(t, limiter, []step{peek(1, true, tt.remaining)})
+
+			limiter.Resize(5, 1, time.Hour)
+			if got := limiter.Peek(1).Limit; got != 5 {
+				t.Errorf("limit after shrinking = %d, want 5", got)
+			}
+		})
+	}
+}
+
+func TestNewLimiter(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits Limits
+		want   string
+		err    bool
+	}{
+		{name: "default is token bucket", limits: Limits{Capacity: 1, RatePerSec: 1, RefillPeriod: time.Second}, want: AlgorithmTokenBucket},
+		{name: "gcra", limits: Limits{Algorithm: AlgorithmGCRA, Capacity: 1, RatePerSec: 1, RefillPeriod: time.Second}, want: AlgorithmGCRA},
+		{name: "unknown algorithm", limits: Limits{Algorithm: "leaky", Capacity: 1, RatePerSec: 1, RefillPeriod: time.Second}, err: true},
+		{name: "zero capacity", limits: Limits{Capacity: 0, RatePerSec: 1, RefillPeriod: time.Second}, err: true},
+		{name: "zero rate", limits: Limits{Capacity: 1, RatePerSec: 0, RefillPeriod: time.Second}, err: true},
+		{name: "zero period", limits: Limits{Capacity: 1, RatePerSec: 1}, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter, err := NewLimiter(tt.limits)
+			if (err != nil) != tt.err {
+				t.Fatalf("err = %v, want error %v", err, tt.err)
+			}
+			if err == nil && limiter.Algorithm() != tt.want {
+				t.Errorf("Algorithm() = %q, want %q", limiter.Algorithm(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,307 @@
+package ratelimiter
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PeerSyncPath — путь на служебном порту, куда реплики присылают свои счетчики
+const PeerSyncPath = "/ratelimit/sync"
+
+// peerSignatureHeader — HMAC-SHA256 тела отчета на общем секрете реплик
+const peerSignatureHeader = "X-RateLimit-Signature"
+
+const (
+	maxPeerReportBytes = 8 << 20
+	// maxPeerCount ограничивает счетчик из отчета, чтобы чужие данные не
+	// переполнили сумму
+	maxPeerCount = 1 << 30
+	// peerStaleIntervals — через сколько интервалов синхронизации счетчики
+	// реплики перестают учитываться, а ее отчет считается устаревшим
+	peerStaleIntervals = 10
+)
+
+// peerReport — счетчики одной реплики. Sent — время отправки в
+// миллисекундах: старые и повторно присланные отчеты отбрасываются.
+type peerReport struct {
+	Replica string           `json:"replica"`
+	Sent    int64            `json:"sent"`
+	Counts  map[string]int64 `json:"counts"`
+}
+
+type peerCounts struct {
+	counts   map[string]int64
+	sent     int64
+	received time.Time
+}
+
+// PeerStore обходится без общего хранилища: каждая реплика считает свои
+// запросы и периодически рассылает счетчики остальным, а суммарная нагрузка
+// складывается из своих и последних полученных чужих счетчиков. Лимит
+// соблюдается с точностью до интервала синхронизации.
+type PeerStore struct {
+	replica  string
+	peers    []string
+	secret   []byte
+	interval time.Duration
+	client   *http.Client
+
+	local  map[string]*memoryCounter
+	remote map[string]*peerCounts
+	mu     sync.Mutex
+
+	stop chan struct{}
+	once sync.Once
+}
+
+// NewPeerStore запускает рассылку счетчиков на peers — базовые URL служебных
+// портов остальных реплик, например "http://10.0.0.2:9090". Отчеты
+// подписываются общим секретом secret; отчеты без верной подписи не
+// принимаются.
+func NewPeerStore(replica string, peers []string, interval time.Duration, secret string) (*PeerStore, error) {
+	if secret == "" {
+		return nil, fmt.Errorf("rate limit peer sync requires a shared secret")
+	}
+	if interval <= 0 {
+		interval = 200 * time.Millisecond
+	}
+	s := &PeerStore{
+		replica:  replica,
+		peers:    peers,
+		secret:   []byte(secret),
+		interval: interval,
+		client:   &http.Client{Timeout: interval},
+		local:    make(map[string]*memoryCounter),
+		remote:   make(map[string]*peerCounts),
+		stop:     make(chan struct{}),
+	}
+	go s.syncLoop()
+	return s, nil
+}
+
+// CheckPeers проверяет список peers: каждый элемент — абсолютный URL, и ни
+// один не указывает на служебный порт adminPort этой же реплики, иначе
+// реплика считала бы свои запросы дважды
+func CheckPeers(peers []string, adminPort string) error {
+	hostname, _ := os.Hostname()
+	addrs, _ := net.InterfaceAddrs()
+	for _, peer := range peers {
+		u, err := url.Parse(peer)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("rate limit peer %q must be an absolute URL", peer)
+		}
+		port := u.Port()
+		if port == "" {
+			port = "80"
+			if u.Scheme == "https" {
+				port = "443"
+			}
+		}
+		if port == adminPort && isLocalHost(u.Hostname(), hostname, addrs) {
+			return fmt.Errorf("rate limit peer %q points at this replica", peer)
+		}
+	}
+	return nil
+}
+
+// isLocalHost сообщает, что host — имя или адрес этой машины
+func isLocalHost(host, hostname string, addrs []net.Addr) bool {
+	if strings.EqualFold(host, "localhost") || (hostname != "" && strings.EqualFold(host, hostname)) {
+		return true
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	if ip.IsLoopback() || ip.IsUnspecified() {
+		return true
+	}
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// staleAfter — возраст, после которого отчет реплики не учитывается
+func (s *PeerStore) staleAfter() time.Duration {
+	return peerStaleIntervals * s.interval
+}
+
+// sign — HMAC-SHA256 тела отчета на общем секрете
+func (s *PeerStore) sign(body []byte) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+func (s *PeerStore) Add(_ context.Context, key string, start time.Time, window time.Duration, n int64) (int64, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	currentKey := windowKey(key, start)
+	counter, exists := s.local[currentKey]
+	if !exists {
+		counter = &memoryCounter{expires: start.Add(2 * window)}
+		s.local[currentKey] = counter
+	}
+	counter.value += n
+
+	current := counter.value + s.remoteCount(currentKey)
+	previousKey := windowKey(key, start.Add(-window))
+	previous := s.remoteCount(previousKey)
+	if prev, exists := s.local[previousKey]; exists {
+		previous += prev.value
+	}
+	return current, previous, nil
+}
+
+// remoteCount суммирует счетчики реплик, от которых недавно были данные.
+// Вызывается под s.mu.
+func (s *PeerStore) remoteCount(key string) int64 {
+	var total int64
+	for _, peer := range s.remote {
+		if time.Since(peer.received) < s.staleAfter() {
+			total += peer.counts[key]
+		}
+	}
+	return total
+}
+
+// ServeHTTP принимает счетчики другой реплики
+func (s *PeerStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPeerReportBytes))
+	if err != nil {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+	signature, err := hex.DecodeString(r.Header.Get(peerSignatureHeader))
+	if err != nil || !hmac.Equal(signature, s.sign(body)) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var report peerReport
+	if err := json.Unmarshal(body, &report); err != nil || report.Replica == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if report.Replica == s.replica {
+		// Ссылки на себя отсекает CheckPeers, значит, у двух реплик один replica_id
+		log.Printf("Rejected rate limit report from another replica with the same ID %s", s.replica)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	// Перехваченный отчет нельзя прислать позже, чтобы заморозить счетчики
+	if age := time.Since(time.UnixMilli(report.Sent)); age > s.staleAfter() || age < -s.staleAfter() {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	counts := make(map[string]int64, len(report.Counts))
+	for key, count := range report.Counts {
+		if count <= 0 {
+			continue
+		}
+		counts[key] = min(count, maxPeerCount)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if prev, exists := s.remote[report.Replica]; exists && report.Sent <= prev.sent {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	s.remote[report.Replica] = &peerCounts{counts: counts, sent: report.Sent, received: time.Now()}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *PeerStore) Close() error {
+	s.once.Do(func() { close(s.stop) })
+	return nil
+}
+
+func (s *PeerStore) syncLoop() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	failing := make(map[string]bool)
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+
+		body, err := json.Marshal(peerReport{Replica: s.replica, Sent: time.Now().UnixMilli(), Counts: s.snapshot()})
+		if err != nil {
+			continue
+		}
+		for _, peer := range s.peers {
+			err := s.push(peer, body)
+			// Пишем в лог только смену состояния, чтобы не засорять его каждые interval
+			if (err != nil) != failing[peer] {
+				failing[peer] = err != nil
+				if err != nil {
+					log.Printf("Rate limit sync to %s failed: %v", peer, err)
+				} else {
+					log.Printf("Rate limit sync to %s recovered", peer)
+				}
+			}
+		}
+	}
+}
+
+func (s *PeerStore) push(peer string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(peer, "/")+PeerSyncPath, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(peerSignatureHeader, hex.EncodeToString(s.sign(body)))
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// snapshot удаляет истекшие счетчики и возвращает копию остальных
+func (s *PeerStore) snapshot() map[string]int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	counts := make(map[string]int64, len(s.local))
+	for key, counter := range s.local {
+		if now.After(counter.expires) {
+			delete(s.local, key)
+			continue
+		}
+		counts[key] = counter.value
+	}
+	return counts
+}
@@ -0,0 +1,290 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"loadbalancer/internal/domain"
+	"loadbalancer/internal/interfaces/repositories"
+)
+
+// ValidQuota проверяет квоту клиента; пустые Period и Window заменяются на
+// "month" и "calendar"
+func ValidQuota(quota *domain.Quota) error {
+	if quota.Limit < 0 {
+		return fmt.Errorf("quota limit cannot be negative")
+	}
+	if quota.Limit == 0 {
+		*quota = domain.Quota{}
+		return nil
+	}
+	switch quota.Period {
+	case "":
+		quota.Period = domain.QuotaMonth
+	case domain.QuotaHour, domain.QuotaDay, domain.QuotaMonth:
+	default:
+		return fmt.Errorf("unknown quota period %q", quota.Period)
+	}
+	switch quota.Window {
+	case "":
+		quota.Window = domain.QuotaCalendar
+	case domain.QuotaCalendar, domain.QuotaRolling:
+	default:
+		return fmt.Errorf("unknown quota window %q", quota.Window)
+	}
+	return nil
+}
+
+// QuotaWindow — длина периода квоты; месяц считается за 30 суток
+func QuotaWindow(period string) time.Duration {
+	switch period {
+	case domain.QuotaHour:
+		return time.Hour
+	case domain.QuotaDay:
+		return 24 * time.Hour
+	default:
+		return 30 * 24 * time.Hour
+	}
+}
+
+// quotaSlot — интервал, которым скользящее окно сдвигается: минута для часа,
+// час для суток и сутки для месяца
+func quotaSlot(period string) time.Duration {
+	switch period {
+	case domain.QuotaHour:
+		return time.Minute
+	case domain.QuotaDay:
+		return time.Hour
+	default:
+		return 24 * time.Hour
+	}
+}
+
+func calendarStart(period string, now time.Time) time.Time {
+	now = now.UTC()
+	switch period {
+	case domain.QuotaHour:
+		return now.Truncate(time.Hour)
+	case domain.QuotaDay:
+		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+}
+
+func calendarEnd(period string, start time.Time) time.Time {
+	switch period {
+	case domain.QuotaHour:
+		return start.Add(time.Hour)
+	case domain.QuotaDay:
+		return start.AddDate(0, 0, 1)
+	default:
+		return start.AddDate(0, 1, 0)
+	}
+}
+
+type quotaState struct {
+	quota domain.Quota
+	usage domain.QuotaUsage
+}
+
+// normalize отбрасывает расход, вышедший из окна
+func (s *quotaState) normalize(now time.Time) {
+	if s.quota.Window == domain.QuotaCalendar {
+		if start := calendarStart(s.quota.Period, now); !s.usage.Start.Equal(start) {
+			s.usage = domain.QuotaUsage{Start: start}
+		}
+		return
+	}
+
+	slot := quotaSlot(s.quota.Period)
+	cutoff := now.Add(-QuotaWindow(s.quota.Period))
+	n := 0
+	for n < len(s.usage.Buckets) && !s.usage.Buckets[n].Start.Add(slot).After(cutoff) {
+		n++
+	}
+	s.usage.Buckets = append(s.usage.Buckets[:0], s.usage.Buckets[n:]...)
+	s.usage.Start = cutoff
+	s.usage.Used = 0
+	for _, bucket := range s.usage.Buckets {
+		s.usage.Used += bucket.Count
+	}
+}
+
+func (s *quotaState) add(now time.Time, n int64) {
+	s.usage.Used += n
+	if s.quota.Window == domain.QuotaCalendar {
+		return
+	}
+
+	start := now.Truncate(quotaSlot(s.quota.Period))
+	if last := len(s.usage.Buckets) - 1; last >= 0 && s.usage.Buckets[last].Start.Equal(start) {
+		s.usage.Buckets[last].Count += n
+		return
+	}
+	s.usage.Buckets = append(s.usage.Buckets, domain.QuotaBucket{Start: start, Count: n})
+}
+
+// refund уменьшает расход на n, списанных в момент taken. Расход не
+// становится отрицательным.
+func (s *quotaState) refund(taken time.Time, n int64) bool {
+	if s.quota.Window == domain.QuotaCalendar {
+		if !s.usage.Start.Equal(calendarStart(s.quota.Period, taken)) {
+			return false
+		}
+		s.usage.Used = max(s.usage.Used-n, 0)
+		return true
+	}
+
+	start := taken.Truncate(quotaSlot(s.quota.Period))
+	for i := range s.usage.Buckets {
+		bucket := &s.usage.Buckets[i]
+		if !bucket.Start.Equal(start) {
+			continue
+		}
+		returned := min(n, bucket.Count)
+		bucket.Count -= returned
+		s.usage.Used -= returned
+		return returned > 0
+	}
+	return false
+}
+
+func (s *quotaState) report(now time.Time) domain.QuotaReport {
+	report := domain.QuotaReport{
+		Quota:     s.quota,
+		Used:      s.usage.Used,
+		Remaining: s.quota.Limit - s.usage.Used,
+		Start:     s.usage.Start,
+		ResetAt:   now,
+	}
+	if report.Remaining < 0 {
+		report.Remaining = 0
+	}
+	if s.quota.Window == domain.QuotaCalendar {
+		report.ResetAt = calendarEnd(s.quota.Period, s.usage.Start)
+	} else if len(s.usage.Buckets) > 0 {
+		oldest := s.usage.Buckets[0].Start
+		report.ResetAt = oldest.Add(quotaSlot(s.quota.Period) + QuotaWindow(s.quota.Period))
+	}
+	return report
+}
+
+// QuotaTracker считает расход долгосрочных квот клиентов. Счетчики живут в
+// памяти и периодически сохраняются в репозиторий клиентов вызовом Flush.
+type QuotaTracker struct {
+	clients map[string]*quotaState
+	dirty   map[string]bool
+	repo    repositories.ClientRepository
+	mu      sync.Mutex
+}
+
+func NewQuotaTracker(repo repositories.ClientRepository) *QuotaTracker {
+	return &QuotaTracker{
+		clients: make(map[string]*quotaState),
+		dirty:   make(map[string]bool),
+		repo:    repo,
+	}
+}
+
+// Take списывает n запросов из квоты клиента в момент now, если квота это
+// позволяет
+func (t *QuotaTracker) Take(client *domain.Client, n int64, now time.Time) (domain.QuotaReport, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state := t.state(client)
+	state.normalize(now)
+	if state.usage.Used+n > state.quota.Limit {
+		return state.report(now), false
+	}
+	state.add(now, n)
+	t.dirty[client.ID] = true
+	return state.report(now), true
+}
+
+// Refund возвращает в квоту запросы, которые в итоге не были пропущены.
+// taken — момент, переданный в Take: запросы возвращаются в то окно или
+// интервал, из которого были списаны, а если он уже вышел из окна, возвращать
+// нечего.
+func (t *QuotaTracker) Refund(clientID string, n int64, taken time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if state, exists := t.clients[clientID]; exists && state.refund(taken, n) {
+		t.dirty[clientID] = true
+	}
+}
+
+// Report возвращает текущий расход квоты клиента
+func (t *QuotaTracker) Report(client *domain.Client) domain.QuotaReport {
+	if client.Quota.Limit <= 0 {
+		return domain.QuotaReport{}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	state := t.state(client)
+	state.normalize(now)
+	return state.report(now)
+}
+
+// Forget удаляет счетчики удаленного клиента
+func (t *QuotaTracker) Forget(clientID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.clients, clientID)
+	delete(t.dirty, clientID)
+}
+
+// Flush сохраняет измененные счетчики в репозиторий клиентов
+func (t *QuotaTracker) Flush() {
+	t.mu.Lock()
+	usages := make(map[string]domain.QuotaUsage, len(t.dirty))
+	for clientID := range t.dirty {
+		usage := t.clients[clientID].usage
+		usage.Buckets = append([]domain.QuotaBucket(nil), usage.Buckets...)
+		usages[clientID] = usage
+	}
+	t.dirty = make(map[string]bool)
+	t.mu.Unlock()
+
+	if len(usages) == 0 {
+		return
+	}
+	if err := t.repo.UpdateUsage(usages); err != nil {
+		log.Printf("Failed to save quota usage: %v", err)
+		t.mu.Lock()
+		for clientID := range usages {
+			if _, exists := t.clients[clientID]; exists {
+				t.dirty[clientID] = true
+			}
+		}
+		t.mu.Unlock()
+	}
+}
+
+// state возвращает счетчики клиента, при первом обращении — сохраненные
+// в записи клиента. Если у клиента сменился период или окно квоты, расход
+// начинается заново. Вызывается под t.mu.
+func (t *QuotaTracker) state(client *domain.Client) *quotaState {
+	state, exists := t.clients[client.ID]
+	if !exists {
+		usage := client.Usage
+		usage.Buckets = append([]domain.QuotaBucket(nil), usage.Buckets...)
+		state = &quotaState{quota: client.Quota, usage: usage}
+		t.clients[client.ID] = state
+	}
+	if state.quota != client.Quota {
+		if state.quota.Period != client.Quota.Period || state.quota.Window != client.Quota.Window {
+			state.usage = domain.QuotaUsage{}
+		}
+		state.quota = client.Quota
+	}
+	return state
+}
@@ -0,0 +1,59 @@
+package ratelimiter
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"loadbalancer/pkg/resp"
+)
+
+// RedisStore хранит счетчики в Redis или совместимом сервере. Для каждого
+// запроса выполняется один конвейер INCRBY + PEXPIRE + GET, поэтому
+// скрипты Lua не нужны.
+type RedisStore struct {
+	client *resp.Client
+}
+
+func NewRedisStore(opts resp.Options) *RedisStore {
+	return &RedisStore{client: resp.NewClient(opts)}
+}
+
+func (s *RedisStore) Add(ctx context.Context, key string, start time.Time, window time.Duration, n int64) (int64, int64, error) {
+	currentKey := windowKey(key, start)
+	ttl := start.Add(2 * window).Sub(time.Now())
+	if ttl < time.Millisecond {
+		ttl = time.Millisecond
+	}
+
+	replies, err := s.client.Pipeline(ctx,
+		[]string{"INCRBY", currentKey, strconv.FormatInt(n, 10)},
+		[]string{"PEXPIRE", currentKey, strconv.FormatInt(ttl.Milliseconds(), 10)},
+		[]string{"GET", windowKey(key, start.Add(-window))},
+	)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, reply := range replies {
+		if e, ok := reply.(resp.Error); ok {
+			return 0, 0, e
+		}
+	}
+
+	current, ok := replies[0].(int64)
+	if !ok {
+		return 0, 0, fmt.Errorf("unexpected INCRBY reply %v", replies[0])
+	}
+	var previous int64
+	if raw, ok := replies[2].(string); ok {
+		if previous, err = strconv.ParseInt(raw, 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("unexpected GET reply %q", raw)
+		}
+	}
+	return current, previous, nil
+}
+
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,115 @@
+package ratelimiter
+
+import (
+	"sync"
+	"time"
+)
+
+// SlidingLog хранит время каждого пропущенного запроса за последнее окно.
+// Самый точный из оконных алгоритмов, но память растет с емкостью.
+type SlidingLog struct {
+	capacity int
+	window   time.Duration
+	log      []time.Time // по возрастанию времени
+	mu       sync.Mutex
+}
+
+func NewSlidingLog(capacity, refillRate int, refillPeriod time.Duration) *SlidingLog {
+	return &SlidingLog{
+		capacity: capacity,
+		window:   windowFor(capacity, refillRate, refillPeriod),
+		log:      make([]time.Time, 0, capacity),
+	}
+}
+
+// Take записывает запрос стоимостью cost как cost записей журнала
+func (l *SlidingLog) Take(cost int) Result {
+	return l.take(cost, true)
+}
+
+func (l *SlidingLog) Peek(cost int) Result {
+	return l.take(cost, false)
+}
+
+func (l *SlidingLog) take(cost int, consume bool) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.expire(now)
+
+	next := clampCost(cost, l.capacity)
+	result := Result{Limit: l.capacity, Window: l.window}
+	if len(l.log)+next <= l.capacity {
+		if consume {
+			l.record(now, next)
+			next = 1
+		}
+		result.Allowed = true
+	}
+
+	result.Remaining = l.capacity - len(l.log)
+	if result.Remaining < 0 {
+		result.Remaining = 0
+	}
+	if len(l.log) > 0 {
+		// Место освобождается, когда из окна выходят самые старые запросы
+		if over := len(l.log) + next - l.capacity; over > 0 {
+			result.RetryAfter = l.log[over-1].Add(l.window).Sub(now)
+		}
+		result.Reset = l.log[len(l.log)-1].Add(l.window).Sub(now)
+	}
+	return result
+}
+
+// Debit дописывает в журнал cost записей; журнал не длиннее двух емкостей
+func (l *SlidingLog) Debit(cost int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.expire(now)
+	if room := 2*l.capacity - len(l.log); cost > room {
+		cost = room
+	}
+	l.record(now, cost)
+}
+
+// record добавляет n записей с временем now. Вызывается под l.mu.
+func (l *SlidingLog) record(now time.Time, n int) {
+	for i := 0; i < n; i++ {
+		l.log = append(l.log, now)
+	}
+}
+
+// Resize сохраняет долю израсходованной квоты: при уменьшении емкости в
+// журнале остаются самые новые записи в количестве, пропорциональном новой
+// емкости, при увеличении журнал сохраняется целиком
+func (l *SlidingLog) Resize(capacity, refillRate int, refillPeriod time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.expire(time.Now())
+	keep := len(l.log) * capacity / l.capacity
+	if keep > len(l.log) {
+		keep = len(l.log)
+	}
+	l.log = append(l.log[:0], l.log[len(l.log)-keep:]...)
+	l.capacity = capacity
+	l.window = windowFor(capacity, refillRate, refillPeriod)
+}
+
+func (l *SlidingLog) Algorithm() string {
+	return AlgorithmSlidingLog
+}
+
+// expire удаляет записи, вышедшие из окна. Вызывается под l.mu.
+func (l *SlidingLog) expire(now time.Time) {
+	n := 0
+	for n < len(l.log) && now.Sub(l.log[n]) >= l.window {
+		n++
+	}
+	if n > 0 {
+		l.log = append(l.log[:0], l.log[n:]...)
+	}
+}
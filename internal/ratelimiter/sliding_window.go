@@ -0,0 +1,133 @@
+package ratelimiter
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// SlidingWindow — счетчик скользящего окна. Хранит число запросов в текущем
+// и предыдущем окне фиксированной длины; нагрузка за последнее окно
+// оценивается как взвешенная сумма, где вес предыдущего окна убывает по мере
+// продвижения текущего.
+type SlidingWindow struct {
+	capacity int
+	window   time.Duration
+	start    time.Time // начало текущего окна
+	previous float64
+	current  float64
+	mu       sync.Mutex
+}
+
+func NewSlidingWindow(capacity, refillRate int, refillPeriod time.Duration) *SlidingWindow {
+	return &SlidingWindow{
+		capacity: capacity,
+		window:   windowFor(capacity, refillRate, refillPeriod),
+		start:    time.Now(),
+	}
+}
+
+func (s *SlidingWindow) Take(cost int) Result {
+	return s.take(cost, true)
+}
+
+func (s *SlidingWindow) Peek(cost int) Result {
+	return s.take(cost, false)
+}
+
+func (s *SlidingWindow) take(cost int, consume bool) Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.advance(now)
+
+	next := float64(clampCost(cost, s.capacity))
+	result := Result{Limit: s.capacity, Window: s.window}
+	if s.estimate(now)+next <= float64(s.capacity) {
+		if consume {
+			s.current += next
+			next = 1
+		}
+		result.Allowed = true
+	}
+
+	result.Remaining = int(math.Floor(float64(s.capacity) - s.estimate(now)))
+	if result.Remaining < 0 {
+		result.Remaining = 0
+	}
+	if s.estimate(now)+next > float64(s.capacity) {
+		result.RetryAfter = s.until(now, float64(s.capacity)-next)
+	}
+	result.Reset = s.until(now, 0)
+	return result
+}
+
+// Debit добавляет cost к счетчику текущего окна; счетчик не больше двух емкостей
+func (s *SlidingWindow) Debit(cost int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.advance(time.Now())
+	s.current = math.Min(s.current+float64(cost), float64(2*s.capacity))
+}
+
+// Resize масштабирует счетчики пропорционально новой емкости
+func (s *SlidingWindow) Resize(capacity, refillRate int, refillPeriod time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.advance(time.Now())
+	scale := float64(capacity) / float64(s.capacity)
+	s.previous *= scale
+	s.current *= scale
+	s.capacity = capacity
+	s.window = windowFor(capacity, refillRate, refillPeriod)
+}
+
+func (s *SlidingWindow) Algorithm() string {
+	return AlgorithmSlidingWindow
+}
+
+// advance сдвигает окно к текущему времени. Вызывается под s.mu.
+func (s *SlidingWindow) advance(now time.Time) {
+	passed := now.Sub(s.start) / s.window
+	switch {
+	case passed <= 0:
+		return
+	case passed == 1:
+		s.previous, s.current = s.current, 0
+	default:
+		s.previous, s.current = 0, 0
+	}
+	s.start = s.start.Add(passed * s.window)
+}
+
+// estimate — оценка числа запросов за последнее окно. Вызывается под s.mu.
+func (s *SlidingWindow) estimate(now time.Time) float64 {
+	weight := 1 - float64(now.Sub(s.start))/float64(s.window)
+	return s.previous*weight + s.current
+}
+
+// until — через сколько оценка опустится до target. Вызывается под s.mu.
+func (s *SlidingWindow) until(now time.Time, target float64) time.Duration {
+	return slidingUntil(now.Sub(s.start), s.window, s.previous, s.current, target)
+}
+
+// slidingUntil — через сколько оценка скользящего окна опустится до target,
+// если с начала текущего окна прошло elapsed
+func slidingUntil(elapsed, window time.Duration, previous, current, target float64) time.Duration {
+	if current <= target {
+		if previous <= 0 {
+			return 0
+		}
+		at := time.Duration(float64(window) * (1 - (target-current)/previous))
+		if at <= elapsed {
+			return 0
+		}
+		return at - elapsed
+	}
+	// В текущем окне не успеет: в следующем текущий счетчик станет предыдущим
+	at := time.Duration(float64(window) * (1 - target/current))
+	return window - elapsed + at
+}
@@ -0,0 +1,83 @@
+package ratelimiter
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Store — общее для реплик балансировщика хранилище счетчиков скользящего
+// окна. Счетчики привязаны к началу окна, поэтому реплики с синхронными
+// часами считают запросы в одних и тех же окнах.
+type Store interface {
+	// Add прибавляет n к счетчику окна start для ключа key и возвращает
+	// суммарные по всем репликам счетчики этого и предыдущего окна
+	Add(ctx context.Context, key string, start time.Time, window time.Duration, n int64) (current, previous int64, err error)
+	Close() error
+}
+
+// windowKey — ключ счетчика окна, начинающегося в start
+func windowKey(key string, start time.Time) string {
+	return key + ":" + strconv.FormatInt(start.UnixMilli(), 10)
+}
+
+type memoryCounter struct {
+	value   int64
+	expires time.Time
+}
+
+// MemoryStore хранит счетчики в памяти процесса. Заменяет Redis в тестах и
+// при запуске одной реплики.
+type MemoryStore struct {
+	counters  map[string]*memoryCounter
+	lastSweep time.Time
+	mu        sync.Mutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		counters:  make(map[string]*memoryCounter),
+		lastSweep: time.Now(),
+	}
+}
+
+func (s *MemoryStore) Add(_ context.Context, key string, start time.Time, window time.Duration, n int64) (int64, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	currentKey := windowKey(key, start)
+	counter, exists := s.counters[currentKey]
+	if !exists {
+		// Счетчик нужен, пока окно может быть предыдущим для следующего
+		counter = &memoryCounter{expires: start.Add(2 * window)}
+		s.counters[currentKey] = counter
+	}
+	counter.value += n
+
+	var previous int64
+	if prev, exists := s.counters[windowKey(key, start.Add(-window))]; exists {
+		previous = prev.value
+	}
+	return counter.value, previous, nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// sweep раз в минуту удаляет истекшие счетчики. Вызывается под s.mu.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	for key, counter := range s.counters {
+		if now.After(counter.expires) {
+			delete(s.counters, key)
+		}
+	}
+	s.lastSweep = now
+}
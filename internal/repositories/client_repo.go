@@ -3,33 +3,61 @@ package repositories
 import (
 	"encoding/json"
 	"errors"
-	"os"
+	"fmt"
+	"reflect"
 	"sync"
 
 	"loadbalancer/internal/domain"
 )
 
 type MemoryClientRepository struct {
-	clients map[string]*domain.Client
-	mu      sync.Mutex
-	file    string 
+	clients   map[string]*domain.Client
+	mu        sync.Mutex
+	file      string
+	listeners []func(domain.ClientEvent)
 }
 
-func NewMemoryClientRepository(file string) *MemoryClientRepository {
+// NewMemoryClientRepository загружает клиентов из file. Если файл есть, но
+// не читается, возвращается ошибка: иначе следующее сохранение затерло бы
+// его пустым списком.
+func NewMemoryClientRepository(file string) (*MemoryClientRepository, error) {
 	repo := &MemoryClientRepository{
 		clients: make(map[string]*domain.Client),
 		file:    file,
 	}
-	repo.loadFromFile()
-	return repo
+	if err := repo.loadFromFile(); err != nil {
+		return nil, fmt.Errorf("load clients from %s: %w", file, err)
+	}
+	return repo, nil
+}
+
+// Репозиторий хранит и отдает копии клиентов: записи в карте не меняются
+// после сохранения, поэтому их можно читать без блокировки.
+func cloneClient(client *domain.Client) *domain.Client {
+	c := *client
+	c.Usage.Buckets = append([]domain.QuotaBucket(nil), client.Usage.Buckets...)
+	return &c
 }
 
+// Save сохраняет клиента. Если записать файл не удалось, запись в памяти
+// откатывается, чтобы лимиты и файл не расходились.
 func (r *MemoryClientRepository) Save(client *domain.Client) error {
 	r.mu.Lock()
-	defer r.mu.Unlock()
+	previous, existed := r.clients[client.ID]
+	r.clients[client.ID] = cloneClient(client)
+	err := r.saveToFile()
+	if err != nil {
+		r.restore(client.ID, previous, existed)
+	}
+	event := domain.ClientEvent{Client: *client}
+	listeners := r.listeners
+	r.mu.Unlock()
 
-	r.clients[client.ID] = client
-	return r.saveToFile()
+	if err != nil {
+		return err
+	}
+	notify(listeners, event)
+	return nil
 }
 
 func (r *MemoryClientRepository) FindByID(id string) (*domain.Client, error) {
@@ -40,24 +68,81 @@ func (r *MemoryClientRepository) FindByID(id string) (*domain.Client, error) {
 	if !exists {
 		return nil, errors.New("client not found")
 	}
-	return client, nil
+	return cloneClient(client), nil
 }
 
 func (r *MemoryClientRepository) Delete(id string) error {
+	r.mu.Lock()
+	previous, existed := r.clients[id]
+	delete(r.clients, id)
+	err := r.saveToFile()
+	if err != nil {
+		r.restore(id, previous, existed)
+	}
+	listeners := r.listeners
+	r.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	notify(listeners, domain.ClientEvent{Client: domain.Client{ID: id}, Deleted: true})
+	return nil
+}
+
+// restore возвращает запись клиента после неудачной записи файла.
+// Вызывается под r.mu.
+func (r *MemoryClientRepository) restore(id string, previous *domain.Client, existed bool) {
+	if existed {
+		r.clients[id] = previous
+	} else {
+		delete(r.clients, id)
+	}
+}
+
+// UpdateUsage сохраняет расход квот клиентов. Лимиты клиентов не меняются,
+// поэтому подписчики не уведомляются.
+func (r *MemoryClientRepository) UpdateUsage(usages map[string]domain.QuotaUsage) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	delete(r.clients, id)
+	changed := false
+	for id, usage := range usages {
+		client, exists := r.clients[id]
+		if !exists || reflect.DeepEqual(client.Usage, usage) {
+			continue
+		}
+		updated := cloneClient(client)
+		updated.Usage = usage
+		r.clients[id] = updated
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
 	return r.saveToFile()
 }
 
+func (r *MemoryClientRepository) Subscribe(listener func(domain.ClientEvent)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.listeners = append(r.listeners, listener)
+}
+
+// notify вызывается без блокировки, чтобы обработчики могли читать репозиторий
+func notify(listeners []func(domain.ClientEvent), event domain.ClientEvent) {
+	for _, listener := range listeners {
+		listener(event)
+	}
+}
+
 func (r *MemoryClientRepository) FindAll() ([]*domain.Client, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	var clients []*domain.Client
 	for _, client := range r.clients {
-		clients = append(clients, client)
+		clients = append(clients, cloneClient(client))
 	}
 	return clients, nil
 }
@@ -71,7 +156,7 @@ func (r *MemoryClientRepository) saveToFile() error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(r.file, data, 0644)
+	return writeFileAtomic(r.file, data)
 }
 
 func (r *MemoryClientRepository) loadFromFile() error {
@@ -79,11 +164,8 @@ func (r *MemoryClientRepository) loadFromFile() error {
 		return nil
 	}
 
-	data, err := os.ReadFile(r.file)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
-		}
+	data, err := readFile(r.file)
+	if err != nil || data == nil {
 		return err
 	}
 
@@ -0,0 +1,54 @@
+package repositories
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+)
+
+// writeFileAtomic записывает файл через временный файл в том же каталоге и
+// переименование, чтобы сбой во время записи не оставил файл обрезанным.
+// Если переименовать нельзя (например, файл смонтирован в контейнер
+// отдельно и замена дает EBUSY), файл перезаписывается на месте.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return os.WriteFile(path, data, 0644)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return os.WriteFile(path, data, 0644)
+	}
+	return nil
+}
+
+// readFile читает файл базы. Отсутствующий, пустой или состоящий из одних
+// пробелов файл считается пустой базой: в образе файл создается через touch.
+func readFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, nil
+	}
+	return data, nil
+}
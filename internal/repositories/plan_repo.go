@@ -0,0 +1,141 @@
+package repositories
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"loadbalancer/internal/domain"
+)
+
+type MemoryPlanRepository struct {
+	plans     map[string]*domain.Plan
+	mu        sync.Mutex
+	file      string
+	listeners []func(domain.PlanEvent)
+}
+
+func NewMemoryPlanRepository(file string) (*MemoryPlanRepository, error) {
+	repo := &MemoryPlanRepository{
+		plans: make(map[string]*domain.Plan),
+		file:  file,
+	}
+	if err := repo.loadFromFile(); err != nil {
+		return nil, fmt.Errorf("load plans from %s: %w", file, err)
+	}
+	return repo, nil
+}
+
+// Save сохраняет план. Если записать файл не удалось, план в памяти
+// откатывается.
+func (r *MemoryPlanRepository) Save(plan *domain.Plan) error {
+	r.mu.Lock()
+	previous, existed := r.plans[plan.Name]
+	stored := *plan
+	r.plans[plan.Name] = &stored
+	err := r.saveToFile()
+	if err != nil {
+		r.restore(plan.Name, previous, existed)
+	}
+	event := domain.PlanEvent{Plan: *plan}
+	listeners := r.listeners
+	r.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	for _, listener := range listeners {
+		listener(event)
+	}
+	return nil
+}
+
+func (r *MemoryPlanRepository) FindByName(name string) (*domain.Plan, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	plan, exists := r.plans[name]
+	if !exists {
+		return nil, errors.New("plan not found")
+	}
+	found := *plan
+	return &found, nil
+}
+
+func (r *MemoryPlanRepository) Delete(name string) error {
+	r.mu.Lock()
+	previous, exists := r.plans[name]
+	if !exists {
+		r.mu.Unlock()
+		return errors.New("plan not found")
+	}
+	delete(r.plans, name)
+	err := r.saveToFile()
+	if err != nil {
+		r.plans[name] = previous
+	}
+	listeners := r.listeners
+	r.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	for _, listener := range listeners {
+		listener(domain.PlanEvent{Plan: domain.Plan{Name: name}, Deleted: true})
+	}
+	return nil
+}
+
+// restore возвращает план после неудачной записи файла. Вызывается под r.mu.
+func (r *MemoryPlanRepository) restore(name string, previous *domain.Plan, existed bool) {
+	if existed {
+		r.plans[name] = previous
+	} else {
+		delete(r.plans, name)
+	}
+}
+
+func (r *MemoryPlanRepository) FindAll() ([]*domain.Plan, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var plans []*domain.Plan
+	for _, plan := range r.plans {
+		found := *plan
+		plans = append(plans, &found)
+	}
+	return plans, nil
+}
+
+func (r *MemoryPlanRepository) Subscribe(listener func(domain.PlanEvent)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.listeners = append(r.listeners, listener)
+}
+
+func (r *MemoryPlanRepository) saveToFile() error {
+	if r.file == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(r.plans)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(r.file, data)
+}
+
+func (r *MemoryPlanRepository) loadFromFile() error {
+	if r.file == "" {
+		return nil
+	}
+
+	data, err := readFile(r.file)
+	if err != nil || data == nil {
+		return err
+	}
+
+	return json.Unmarshal(data, &r.plans)
+}
@@ -2,84 +2,262 @@ package repositories
 
 import (
 	"fmt"
+	"log"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"loadbalancer/internal/balancer"
+	"loadbalancer/internal/breaker"
 	"loadbalancer/internal/domain"
+	"loadbalancer/internal/health"
+	"loadbalancer/internal/metrics"
 )
 
 type MemoryServerRepository struct {
-	servers []*domain.Server
-	current int
-	mu      sync.Mutex
+	servers       []*domain.Server
+	strategy      balancer.Strategy
+	healthPolicy  health.Policy
+	breakerPolicy breaker.Policy
+	mu            sync.Mutex
 }
 
-func NewMemoryServerRepository(backends []string) *MemoryServerRepository {
-	var servers []*domain.Server
-	for _, backend := range backends {
-		if server, err := domain.NewServer(backend); err == nil {
-			servers = append(servers, server)
-		}
+func NewMemoryServerRepository(servers []*domain.Server, strategy balancer.Strategy, healthPolicy health.Policy, breakerPolicy breaker.Policy) *MemoryServerRepository {
+	for _, server := range servers {
+		reportHealth(server)
+	}
+	return &MemoryServerRepository{
+		servers:       servers,
+		strategy:      strategy,
+		healthPolicy:  healthPolicy,
+		breakerPolicy: breakerPolicy,
 	}
-	return &MemoryServerRepository{servers: servers}
 }
 
+// GetAll возвращает снимки серверов, которые можно читать без блокировки
 func (r *MemoryServerRepository) GetAll() []*domain.Server {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	servers := make([]*domain.Server, len(r.servers))
-	copy(servers, r.servers)
+	for i, s := range r.servers {
+		servers[i] = snapshot(s)
+	}
 	return servers
 }
 
+// snapshot копирует сервер по полям: ActiveRequests меняется атомарно без
+// r.mu, и копирование всей структуры читало бы его с гонкой. Вызывается под r.mu.
+func snapshot(s *domain.Server) *domain.Server {
+	circuit := s.Circuit
+	circuit.Window = append([]domain.CircuitBucket(nil), s.Circuit.Window...)
+	circuit.History = append([]domain.CircuitEvent(nil), s.Circuit.History...)
+	return &domain.Server{
+		URL:            s.URL,
+		Healthy:        s.Healthy,
+		State:          s.State,
+		Weight:         s.Weight,
+		CurrentWeight:  s.CurrentWeight,
+		ActiveRequests: atomic.LoadInt64(&s.ActiveRequests),
+		LatencyEWMA:    s.LatencyEWMA,
+		LatencyUpdated: s.LatencyUpdated,
+
+		ConsecutiveSuccesses: s.ConsecutiveSuccesses,
+		ConsecutiveFailures:  s.ConsecutiveFailures,
+		HoldUntil:            s.HoldUntil,
+		HealthHistory:        append([]domain.HealthEvent(nil), s.HealthHistory...),
+
+		Circuit: circuit,
+	}
+}
+
+func (r *MemoryServerRepository) find(rawurl string) (int, *domain.Server) {
+	for i, s := range r.servers {
+		if s.URL.String() == rawurl {
+			return i, s
+		}
+	}
+	return -1, nil
+}
+
+// Add добавляет сервер в балансировку
+func (r *MemoryServerRepository) Add(server *domain.Server) (*domain.Server, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, existing := r.find(server.URL.String()); existing != nil {
+		return nil, fmt.Errorf("server %s already exists", server.URL.String())
+	}
+	r.servers = append(r.servers, server)
+	reportHealth(server)
+	return snapshot(server), nil
+}
+
+// Remove удаляет сервер. Уже проксируемые на него запросы завершаются.
+func (r *MemoryServerRepository) Remove(rawurl string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i, server := r.find(rawurl)
+	if server == nil {
+		return fmt.Errorf("server %s not found", rawurl)
+	}
+	r.servers = append(r.servers[:i:i], r.servers[i+1:]...)
+	metrics.ForgetBackend(rawurl)
+	return nil
+}
+
+// SetState меняет административное состояние сервера. Сервер без активных
+// запросов выводится из балансировки сразу, минуя draining.
+func (r *MemoryServerRepository) SetState(rawurl, state string) (*domain.Server, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, server := r.find(rawurl)
+	if server == nil {
+		return nil, fmt.Errorf("server %s not found", rawurl)
+	}
+	server.State = state
+	r.finishDrain(server)
+	return snapshot(server), nil
+}
+
+// finishDrain переводит сервер из draining в disabled, когда на нем не
+// осталось активных запросов. Вызывается под r.mu.
+func (r *MemoryServerRepository) finishDrain(server *domain.Server) {
+	if server.State != domain.ServerDraining || atomic.LoadInt64(&server.ActiveRequests) > 0 {
+		return
+	}
+	server.State = domain.ServerDisabled
+	log.Printf("Backend %s is drained", server.URL.String())
+}
+
+// SetWeight меняет вес сервера
+func (r *MemoryServerRepository) SetWeight(rawurl string, weight int) (*domain.Server, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, server := r.find(rawurl)
+	if server == nil {
+		return nil, fmt.Errorf("server %s not found", rawurl)
+	}
+	server.Weight = weight
+	server.CurrentWeight = 0
+	return snapshot(server), nil
+}
+
+// UpdateHealth учитывает результат активной проверки здоровья
 func (r *MemoryServerRepository) UpdateHealth(server *domain.Server, healthy bool) {
+	r.observe(server, healthy, "probe")
+}
+
+// ReportResult учитывает результат проксированного запроса в circuit breaker
+func (r *MemoryServerRepository) ReportResult(server *domain.Server, generation uint64, outcome breaker.Outcome, reason string) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	r.breakerPolicy.Record(server, generation, outcome, reason, time.Now(), logCircuit(server))
+}
+
+func logCircuit(server *domain.Server) func(domain.CircuitEvent) {
+	return func(event domain.CircuitEvent) {
+		log.Printf("Circuit for %s: %s -> %s (%s)", server.URL.String(), event.From, event.To, event.Reason)
+		metrics.CircuitTransitions.With(server.URL.String(), event.To).Inc()
+	}
+}
+
+// refreshCircuits переводит разомкнутые цепи в half-open по таймауту
+func (r *MemoryServerRepository) refreshCircuits() {
+	now := time.Now()
 	for _, s := range r.servers {
-		if s.URL.String() == server.URL.String() {
-			s.Healthy = healthy
-			break
+		r.breakerPolicy.Refresh(s, now, logCircuit(s))
+	}
+}
+
+func (r *MemoryServerRepository) observe(server *domain.Server, ok bool, reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, s := r.find(server.URL.String())
+	if s == nil {
+		return
+	}
+	if r.healthPolicy.Observe(s, ok, reason, time.Now()) {
+		state := "down"
+		if s.Healthy {
+			state = "up"
 		}
+		log.Printf("Backend %s is now %s (%s)", s.URL.String(), strings.ToUpper(state), reason)
+		metrics.HealthTransitions.With(s.URL.String(), state).Inc()
+		reportHealth(s)
 	}
 }
 
+func reportHealth(server *domain.Server) {
+	healthy := 0.0
+	if server.Healthy {
+		healthy = 1
+	}
+	metrics.BackendHealthy.With(server.URL.String()).Set(healthy)
+}
 
-func (r *MemoryServerRepository) GetNext() (*domain.Server, error) {
-    r.mu.Lock()
+
+func (r *MemoryServerRepository) GetNext(sel balancer.Selection) (*domain.Server, uint64, error) {
+	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	if len(r.servers) == 0 {
-		return nil, fmt.Errorf("no servers available")
+		return nil, 0, fmt.Errorf("no servers available")
 	}
 
-	startIdx := r.current
-	for {
-		server := r.servers[r.current]
-		r.current = (r.current + 1) % len(r.servers) // Круговая очередь
+	r.refreshCircuits()
+	server, err := r.strategy.Next(r.servers, sel)
+	if err != nil {
+		return nil, 0, err
+	}
+	return server, r.breakerPolicy.OnSelect(server), nil
+}
 
-		if server.Healthy {
-			return server, nil
-		}
+// Get возвращает сервер по URL, если он может принять новый запрос
+func (r *MemoryServerRepository) Get(rawurl string) (*domain.Server, uint64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
-		// Прошли все серверы и не нашли здоровый
-		if r.current == startIdx {
-			return nil, fmt.Errorf("no healthy servers available")
-		}
+	_, server := r.find(rawurl)
+	if server == nil {
+		return nil, 0, fmt.Errorf("server %s not found", rawurl)
 	}
+	r.breakerPolicy.Refresh(server, time.Now(), logCircuit(server))
+	if !server.Available() {
+		return nil, 0, fmt.Errorf("server %s is unavailable", rawurl)
+	}
+	return server, r.breakerPolicy.OnSelect(server), nil
 }
 
-func (r *MemoryServerRepository) MarkUnhealthy(server *domain.Server) error {
+// Acquire отмечает начало проксируемого запроса к серверу
+func (r *MemoryServerRepository) Acquire(server *domain.Server) {
+	atomic.AddInt64(&server.ActiveRequests, 1)
+}
+
+// ObserveLatency учитывает задержку ответа сервера
+func (r *MemoryServerRepository) ObserveLatency(server *domain.Server, rtt time.Duration) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	for _, s := range r.servers {
-		if s.URL.String() == server.URL.String() {
-			s.Healthy = false
-			break
-		}
+	balancer.ObserveLatency(server, rtt, time.Now())
+}
+
+// Release отмечает завершение проксируемого запроса к серверу. Последний
+// запрос к выводимому серверу завершает вывод.
+func (r *MemoryServerRepository) Release(server *domain.Server) {
+	if atomic.AddInt64(&server.ActiveRequests, -1) > 0 {
+		return
 	}
-	return nil
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.finishDrain(server)
 }
 
 func (r *MemoryServerRepository) Count() int {
@@ -0,0 +1,55 @@
+package retry
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+)
+
+// Body хранит тело запроса, чтобы отправлять его повторно
+type Body struct {
+	data       []byte
+	replayable bool
+}
+
+// BufferBody читает тело запроса в память, если оно не больше limit байт.
+// Если тело больше, прочитанная часть возвращается в запрос, а Replayable
+// возвращает false — такой запрос можно отправить только один раз.
+func BufferBody(r *http.Request, limit int64) (*Body, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return &Body{replayable: true}, nil
+	}
+	if r.ContentLength > limit {
+		return &Body{}, nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(data), r.Body), r.Body}
+		return &Body{}, nil
+	}
+	r.Body.Close()
+	return &Body{data: data, replayable: true}, nil
+}
+
+func (b *Body) Replayable() bool {
+	return b.replayable
+}
+
+// Rewind подставляет в запрос буферизованное тело перед очередной попыткой
+func (b *Body) Rewind(r *http.Request) {
+	if !b.replayable || b.data == nil {
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(b.data))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(b.data)), nil
+	}
+	r.ContentLength = int64(len(b.data))
+}
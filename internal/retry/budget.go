@@ -0,0 +1,70 @@
+package retry
+
+import (
+	"sync"
+	"time"
+)
+
+const budgetBuckets = 10
+
+// Budget ограничивает долю повторов от общего трафика: за последние
+// budgetBuckets секунд повторов может быть не больше Ratio от числа запросов
+// плюс MinPerSec в секунду, чтобы при низком трафике повторы не запрещались.
+type Budget struct {
+	ratio     float64
+	minPerSec int
+
+	requests [budgetBuckets]int
+	retries  [budgetBuckets]int
+	seconds  [budgetBuckets]int64
+	mu       sync.Mutex
+}
+
+func NewBudget(ratio float64, minPerSec int) *Budget {
+	return &Budget{ratio: ratio, minPerSec: minPerSec}
+}
+
+// RecordRequest учитывает новый запрос
+func (b *Budget) RecordRequest() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.requests[b.bucket(time.Now())]++
+}
+
+// Withdraw пытается списать повтор из бюджета. Возвращает false, если
+// бюджет исчерпан.
+func (b *Budget) Withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	i := b.bucket(now)
+
+	requests, retries := 0, 0
+	for j := range b.seconds {
+		if now.Unix()-b.seconds[j] < budgetBuckets {
+			requests += b.requests[j]
+			retries += b.retries[j]
+		}
+	}
+
+	allowed := int(b.ratio*float64(requests)) + b.minPerSec*budgetBuckets
+	if retries >= allowed {
+		return false
+	}
+	b.retries[i]++
+	return true
+}
+
+// bucket возвращает индекс корзины текущей секунды, обнуляя устаревшую
+func (b *Budget) bucket(now time.Time) int {
+	sec := now.Unix()
+	i := int(sec % budgetBuckets)
+	if b.seconds[i] != sec {
+		b.seconds[i] = sec
+		b.requests[i] = 0
+		b.retries[i] = 0
+	}
+	return i
+}
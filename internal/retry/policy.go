@@ -0,0 +1,72 @@
+package retry
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Failure — неудачная попытка проксирования запроса
+type Failure struct {
+	Status  int  // код ответа бэкенда, 0 — ответа не было
+	Timeout bool // бэкенд не ответил вовремя
+	Reason  string
+}
+
+func (f *Failure) Error() string {
+	return f.Reason
+}
+
+// Policy определяет, когда и сколько раз запрос повторяется на другом бэкенде
+type Policy struct {
+	MaxAttempts       int
+	Methods           map[string]bool
+	StatusCodes       map[int]bool
+	OnConnectionError bool
+	OnTimeout         bool
+	Backoff           time.Duration
+	MaxBackoff        time.Duration
+	// MaxBodyBytes — тело запроса больше этого размера не буферизуется,
+	// и такой запрос не повторяется
+	MaxBodyBytes int64
+}
+
+// Attempts возвращает число попыток для метода запроса
+func (p Policy) Attempts(method string) int {
+	if p.MaxAttempts <= 1 || !p.Methods[method] {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// RetryStatus сообщает, нужно ли повторить запрос при таком коде ответа
+func (p Policy) RetryStatus(code int) bool {
+	return p.StatusCodes[code]
+}
+
+// Retryable сообщает, можно ли повторить запрос после неудачной попытки
+func (p Policy) Retryable(f *Failure) bool {
+	switch {
+	case f.Status != 0:
+		return p.RetryStatus(f.Status)
+	case f.Timeout:
+		return p.OnTimeout
+	default:
+		return p.OnConnectionError
+	}
+}
+
+// BackoffFor возвращает паузу перед повтором номер attempt (начиная с 1):
+// экспоненциальный рост с полным jitter, не больше MaxBackoff
+func (p Policy) BackoffFor(attempt int) time.Duration {
+	if p.Backoff <= 0 {
+		return 0
+	}
+	backoff := p.Backoff
+	for i := 1; i < attempt && (p.MaxBackoff <= 0 || backoff < p.MaxBackoff); i++ {
+		backoff *= 2
+	}
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	return time.Duration(rand.Int63n(int64(backoff) + 1))
+}
@@ -3,70 +3,535 @@ package server
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
 	"net/http"
+	"os"
+	"regexp"
+	"strings"
 	"sync"
 	"time"
 
+	"loadbalancer/internal/accesslog"
+	"loadbalancer/internal/balancer"
+	"loadbalancer/internal/breaker"
 	"loadbalancer/internal/config"
+	"loadbalancer/internal/domain"
 	"loadbalancer/internal/handlers"
+	"loadbalancer/internal/health"
+	"loadbalancer/internal/metrics"
+	"loadbalancer/internal/ratelimiter"
 	"loadbalancer/internal/repositories"
+	"loadbalancer/internal/retry"
 	"loadbalancer/internal/usecases"
 	util "loadbalancer/pkg/httputil"
+	"loadbalancer/pkg/proxyproto"
+	"loadbalancer/pkg/resp"
 )
 
 type LoadBalancerServer struct {
 	server     		*http.Server
+	proxyListener	func(net.Listener) net.Listener // nil, если PROXY protocol выключен
+	adminServer		*http.Server // nil, если admin_port не задан
 	healthChecker 	util.HealthChecker
+	transports 		*util.TransportPool
+	accessLog		io.Closer // nil, если журнал доступа выключен
+	limitStore		ratelimiter.Store // nil, если лимит не распределенный
+	limiter			*ratelimiter.LimiterManager
 	wg         		sync.WaitGroup
 }
 
-func NewLoadBalancerServer(cfg *config.Config) *LoadBalancerServer {
+func NewLoadBalancerServer(cfg *config.Config) (lbs *LoadBalancerServer, err error) {
+	// При ошибке останавливаем в обратном порядке все, что успели запустить
+	var closers []func()
+	defer func() {
+		if err != nil {
+			for i := len(closers) - 1; i >= 0; i-- {
+				closers[i]()
+			}
+		}
+	}()
+
+	strategy, err := balancer.New(cfg.BalancingStrategy)
+	if err != nil {
+		return nil, err
+	}
+	keyFunc, err := balancer.NewKeyFunc(cfg.HashKey.Source, cfg.HashKey.Name)
+	if err != nil {
+		return nil, err
+	}
+	sticky, err := newStickySessions(cfg.StickySessions)
+	if err != nil {
+		return nil, err
+	}
+
 	// Инициализация зависимостей
-	serverRepo := repositories.NewMemoryServerRepository(cfg.Backends)
-	clientRepo := repositories.NewMemoryClientRepository(cfg.ClientsDB)
-	healthChecker := util.NewHealthChecker(2 * time.Second)
+	serverRepo := repositories.NewMemoryServerRepository(newServers(cfg.Backends), strategy, newHealthPolicy(cfg.HealthPolicy), newBreakerPolicy(cfg.CircuitBreaker))
+	clientRepo, err := repositories.NewMemoryClientRepository(cfg.ClientsDB)
+	if err != nil {
+		return nil, err
+	}
+	planRepo, err := repositories.NewMemoryPlanRepository(cfg.PlansDB)
+	if err != nil {
+		return nil, err
+	}
+	defaultProbe, err := newProbe(cfg.HealthCheck)
+	if err != nil {
+		return nil, err
+	}
+	healthChecker := util.NewHealthChecker(util.Schedule{
+		Interval:    time.Duration(cfg.HealthCheck.IntervalMs) * time.Millisecond,
+		Jitter:      time.Duration(cfg.HealthCheck.JitterMs) * time.Millisecond,
+		Concurrency: cfg.HealthCheck.Concurrency,
+	}, defaultProbe)
+	for _, backend := range cfg.Backends {
+		if backend.HealthCheck == nil {
+			continue
+		}
+		probe, err := newProbe(cfg.HealthCheck.Merge(backend.HealthCheck))
+		if err != nil {
+			return nil, fmt.Errorf("backend %s: %w", backend.URL, err)
+		}
+		healthChecker.SetProbe(backend.URL, probe)
+	}
+
+	transports := util.NewTransportPool(newTransportSettings(cfg.Transport))
 
 	// Инициализация use cases
-	lbUseCase := usecases.NewLoadBalancer(serverRepo, healthChecker)
-	clientUseCase := usecases.NewClientManager(clientRepo)
+	lbUseCase := usecases.NewLoadBalancer(
+		serverRepo,
+		healthChecker,
+		keyFunc,
+		sticky,
+		newRetryPolicy(cfg.Retry),
+		retry.NewBudget(cfg.Retry.BudgetRatio, cfg.Retry.MinRetriesPerSec),
+		transports,
+	)
+	closers = append(closers, healthChecker.Stop, transports.CloseIdleConnections)
+	backendUseCase := usecases.NewBackendManager(serverRepo, transports)
 	
+	identitySources := make([]ratelimiter.IdentitySource, 0, len(cfg.RateLimit.Identity))
+	for _, source := range cfg.RateLimit.Identity {
+		identitySources = append(identitySources, ratelimiter.IdentitySource{
+			Type:  source.Type,
+			Name:  source.Name,
+			Claim: source.Claim,
+		})
+	}
+	identifier, err := ratelimiter.NewIdentifier(identitySources, cfg.RateLimit.AnonymousPolicy, cfg.RateLimit.JWTSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	costRules := make([]ratelimiter.CostRule, 0, len(cfg.RateLimit.CostRules))
+	for _, rule := range cfg.RateLimit.CostRules {
+		costRules = append(costRules, ratelimiter.CostRule{
+			Method:     rule.Method,
+			PathPrefix: rule.PathPrefix,
+			Cost:       rule.Cost,
+			Header:     rule.Header,
+		})
+	}
+	costs, err := ratelimiter.NewCostRules(costRules)
+	if err != nil {
+		return nil, err
+	}
+	for _, rule := range costRules {
+		if rule.Cost > cfg.RateLimit.DefaultCapacity {
+			log.Printf("Cost rule %s %s: cost %d exceeds default capacity %d and is capped at it for clients with default limits",
+				rule.Method, rule.PathPrefix, rule.Cost, cfg.RateLimit.DefaultCapacity)
+		}
+	}
+
+	resolver, err := util.NewClientIPResolver(cfg.ClientIP.TrustedProxies, cfg.ClientIP.Headers)
+	if err != nil {
+		return nil, err
+	}
+
 	// Инициализация обработчиков
-	lbHandler := handlers.NewLoadBalancerHandler(
-		lbUseCase,
-		clientRepo,
-		cfg.RateLimit.DefaultCapacity,
-		cfg.RateLimit.DefaultRatePerSec,
-		time.Duration(cfg.RateLimit.RefillPeriod)*time.Nanosecond,
-	)
+	distributed, err := newDistributed(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var limitStore ratelimiter.Store
+	if distributed != nil {
+		limitStore = distributed.Store
+		closers = append(closers, func() { limitStore.Close() })
+	}
+
+	limiter, err := ratelimiter.NewLimiterManager(clientRepo, planRepo, ratelimiter.Limits{
+		Algorithm:    cfg.RateLimit.DefaultAlgorithm,
+		Capacity:     cfg.RateLimit.DefaultCapacity,
+		RatePerSec:   cfg.RateLimit.DefaultRatePerSec,
+		RefillPeriod: time.Duration(cfg.RateLimit.RefillPeriod) * time.Nanosecond,
+	}, newEviction(cfg.RateLimit), distributed, ratelimiter.Concurrency{
+		DefaultMax: cfg.RateLimit.Concurrency.DefaultMax,
+		Mode:       cfg.RateLimit.Concurrency.Mode,
+		MaxWait:    time.Duration(cfg.RateLimit.Concurrency.MaxWaitMs) * time.Millisecond,
+		MaxQueue:   cfg.RateLimit.Concurrency.MaxQueue,
+	}, quotaFlushInterval(cfg.RateLimit))
+	if err != nil {
+		return nil, err
+	}
+	closers = append(closers, limiter.Close)
+	clientUseCase := usecases.NewClientManager(clientRepo, planRepo, limiter)
+	planUseCase := usecases.NewPlanManager(planRepo, clientRepo, limiter)
+	if err := savePlans(planUseCase, cfg.RateLimit.Plans); err != nil {
+		return nil, err
+	}
+	lbHandler := handlers.NewLoadBalancerHandler(lbUseCase, limiter, identifier, costs)
 	clientHandler := handlers.NewClientHandler(clientUseCase)
+	planHandler := handlers.NewPlanHandler(planUseCase)
+	backendHandler := handlers.NewBackendHandler(backendUseCase)
+
+	var proxyHandler http.Handler = lbHandler
+	var accessLog io.WriteCloser
+	if cfg.AccessLog.Enabled {
+		accessLog, err = accesslog.NewOutput(cfg.AccessLog.Output, int64(cfg.AccessLog.MaxSizeMB)<<20, cfg.AccessLog.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		closers = append(closers, func() { accessLog.Close() })
+		logger, err := accesslog.NewLogger(cfg.AccessLog.Format, accessLog)
+		if err != nil {
+			return nil, err
+		}
+		proxyHandler = accesslog.Middleware(logger, lbHandler)
+	}
 
 	// Настройка маршрутизатора
 	mux := http.NewServeMux()
-	mux.Handle("/", lbHandler)
+	mux.Handle("/", proxyHandler)
 	mux.HandleFunc("/clients/register", clientHandler.RegisterClient)
 	mux.HandleFunc("/clients/update", clientHandler.UpdateClient)
 	mux.HandleFunc("/clients/delete", clientHandler.DeleteClient)
 	mux.HandleFunc("/clients/get", clientHandler.GetClient)
 	mux.HandleFunc("/clients/list", clientHandler.ListClients)
+	mux.HandleFunc("GET /clients/{id}/usage", clientHandler.GetUsage)
+	mux.HandleFunc("/plans/save", planHandler.SavePlan)
+	mux.HandleFunc("/plans/delete", planHandler.DeletePlan)
+	mux.HandleFunc("/plans/get", planHandler.GetPlan)
+	mux.HandleFunc("/plans/list", planHandler.ListPlans)
+	mux.HandleFunc("GET /backends/list", backendHandler.ListBackends)
+	mux.HandleFunc("POST /backends/add", backendHandler.AddBackend)
+	mux.HandleFunc("POST /backends/remove", backendHandler.RemoveBackend)
+	mux.HandleFunc("POST /backends/weight", backendHandler.UpdateWeight)
+	mux.HandleFunc("POST /backends/enable", backendHandler.EnableBackend)
+	mux.HandleFunc("POST /backends/disable", backendHandler.DisableBackend)
+	mux.HandleFunc("POST /backends/drain", backendHandler.DrainBackend)
+
+	// Служебный сервер отделен от порта, на который приходит проксируемый трафик
+	var adminServer *http.Server
+	if cfg.AdminPort != "" {
+		adminMux := http.NewServeMux()
+		adminMux.Handle("/metrics", metrics.Registry.Handler())
+		if peers, ok := limitStore.(*ratelimiter.PeerStore); ok {
+			adminMux.Handle(ratelimiter.PeerSyncPath, peers)
+		}
+		adminServer = &http.Server{
+			Addr:    ":" + cfg.AdminPort,
+			Handler: adminMux,
+		}
+	}
 
 	return &LoadBalancerServer{
 		server: &http.Server{
 			Addr:    ":" + cfg.Port,
-			Handler: mux,
+			Handler: resolver.Middleware(mux),
 		},
+		proxyListener: newProxyListener(cfg.ClientIP, resolver),
+		adminServer: adminServer,
+		accessLog:   accessLog,
+		limitStore:  limitStore,
+		limiter:     limiter,
 		healthChecker: healthChecker,
+		transports:    transports,
+	}, nil
+}
+
+func newServers(backends []config.BackendConfig) []*domain.Server {
+	var servers []*domain.Server
+	for _, backend := range backends {
+		server, err := domain.NewServer(backend.URL, backend.Weight)
+		if err != nil {
+			log.Printf("Skipping backend %s: %v", backend.URL, err)
+			continue
+		}
+		servers = append(servers, server)
+	}
+	return servers
+}
+
+func newHealthPolicy(cfg config.HealthPolicyConfig) health.Policy {
+	return health.Policy{
+		Rise:          cfg.Rise,
+		Fall:          cfg.Fall,
+		FlapWindow:    time.Duration(cfg.FlapWindowMs) * time.Millisecond,
+		FlapThreshold: cfg.FlapThreshold,
+		HoldDown:      time.Duration(cfg.HoldDownMs) * time.Millisecond,
+		MaxHoldDown:   time.Duration(cfg.MaxHoldDownMs) * time.Millisecond,
+	}
+}
+
+func newBreakerPolicy(cfg config.CircuitBreakerConfig) breaker.Policy {
+	policy := breaker.Policy{
+		Enabled:          cfg.Enabled,
+		Window:           time.Duration(cfg.WindowMs) * time.Millisecond,
+		Buckets:          cfg.Buckets,
+		MinRequests:      cfg.MinRequests,
+		FailureRatio:     cfg.FailureRatio,
+		OpenTimeout:      time.Duration(cfg.OpenTimeoutMs) * time.Millisecond,
+		HalfOpenRequests: cfg.HalfOpenRequests,
+	}
+	if policy.Window <= 0 {
+		policy.Window = 10 * time.Second
+	}
+	if policy.Buckets <= 0 {
+		policy.Buckets = 10
+	}
+	if policy.MinRequests <= 0 {
+		policy.MinRequests = 5
+	}
+	if policy.FailureRatio <= 0 {
+		policy.FailureRatio = 0.5
+	}
+	if policy.OpenTimeout <= 0 {
+		policy.OpenTimeout = 5 * time.Second
+	}
+	return policy
+}
+
+func newTransportSettings(cfg config.TransportConfig) util.TransportSettings {
+	ms := func(v, def int) time.Duration {
+		if v == 0 {
+			v = def
+		}
+		return time.Duration(v) * time.Millisecond
+	}
+	settings := util.TransportSettings{
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.MaxConnsPerHost,
+		IdleConnTimeout:       ms(cfg.IdleConnTimeoutMs, 90000),
+		DialTimeout:           ms(cfg.DialTimeoutMs, 5000),
+		KeepAlive:             ms(cfg.KeepAliveMs, 30000),
+		TLSHandshakeTimeout:   ms(cfg.TLSHandshakeTimeoutMs, 10000),
+		ResponseHeaderTimeout: ms(cfg.ResponseHeaderTimeoutMs, 0),
+		ExpectContinueTimeout: ms(cfg.ExpectContinueTimeoutMs, 1000),
+		HTTP2:                 cfg.HTTP2,
+	}
+	// Стандартные 2 простаивающих соединения на хост слишком мало для прокси
+	if settings.MaxIdleConnsPerHost <= 0 {
+		settings.MaxIdleConnsPerHost = 64
+	}
+	if settings.MaxIdleConns <= 0 {
+		settings.MaxIdleConns = 512
+	}
+	return settings
+}
+
+func newRetryPolicy(cfg config.RetryConfig) retry.Policy {
+	policy := retry.Policy{
+		MaxAttempts:       cfg.MaxAttempts,
+		Methods:           make(map[string]bool),
+		StatusCodes:       make(map[int]bool),
+		OnConnectionError: cfg.OnConnectionError,
+		OnTimeout:         cfg.OnTimeout,
+		Backoff:           time.Duration(cfg.BackoffMs) * time.Millisecond,
+		MaxBackoff:        time.Duration(cfg.MaxBackoffMs) * time.Millisecond,
+		MaxBodyBytes:      cfg.MaxBodyBytes,
+	}
+	for _, method := range cfg.Methods {
+		policy.Methods[strings.ToUpper(method)] = true
+	}
+	for _, code := range cfg.StatusCodes {
+		policy.StatusCodes[code] = true
+	}
+	if policy.MaxBodyBytes <= 0 {
+		policy.MaxBodyBytes = 1 << 20
+	}
+	return policy
+}
+
+func newProbe(cfg config.HealthCheckConfig) (util.Probe, error) {
+	probe := util.DefaultProbe()
+	if cfg.Path != "" {
+		probe.Path = cfg.Path
+	}
+	if cfg.Method != "" {
+		probe.Method = cfg.Method
+	}
+	probe.Headers = cfg.Headers
+	if len(cfg.ExpectedStatus) > 0 {
+		ranges, err := util.ParseStatusRanges(cfg.ExpectedStatus)
+		if err != nil {
+			return probe, err
+		}
+		probe.ExpectedStatus = ranges
+	}
+	probe.BodyContains = cfg.BodyContains
+	if cfg.BodyRegex != "" {
+		re, err := regexp.Compile(cfg.BodyRegex)
+		if err != nil {
+			return probe, fmt.Errorf("invalid health check body regex: %w", err)
+		}
+		probe.BodyRegex = re
+	}
+	if cfg.TimeoutMs > 0 {
+		probe.Timeout = time.Duration(cfg.TimeoutMs) * time.Millisecond
+	}
+	return probe, nil
+}
+
+// savePlans создает планы из конфигурации, которых еще нет в plans_db.
+// Сохраненные планы не перезаписываются, чтобы не терять изменения из API.
+func savePlans(uc *usecases.PlanManager, plans []config.PlanConfig) error {
+	for _, p := range plans {
+		plan := &domain.Plan{
+			Name:          p.Name,
+			Capacity:      p.Capacity,
+			RatePerSec:    p.RatePerSec,
+			Algorithm:     p.Algorithm,
+			MaxConcurrent: p.MaxConcurrent,
+			Quota: domain.Quota{
+				Limit:  p.Quota.Limit,
+				Period: p.Quota.Period,
+				Window: p.Quota.Window,
+			},
+		}
+		if _, err := uc.GetPlan(p.Name); err == nil {
+			continue
+		}
+		if err := uc.SavePlan(plan); err != nil {
+			return fmt.Errorf("plan %q: %w", p.Name, err)
+		}
+	}
+	return nil
+}
+
+// quotaFlushInterval — как часто расход квот сохраняется в файл клиентов
+func quotaFlushInterval(cfg config.RateLimitConfig) time.Duration {
+	if cfg.QuotaFlushMs <= 0 {
+		return 5 * time.Second
+	}
+	return time.Duration(cfg.QuotaFlushMs) * time.Millisecond
+}
+
+func newEviction(cfg config.RateLimitConfig) ratelimiter.Eviction {
+	eviction := ratelimiter.Eviction{
+		IdleTTL:    time.Duration(cfg.DefaultBucketTTLMs) * time.Millisecond,
+		MaxBuckets: cfg.MaxDefaultBuckets,
+	}
+	if eviction.IdleTTL <= 0 {
+		eviction.IdleTTL = 10 * time.Minute
+	}
+	if eviction.MaxBuckets <= 0 {
+		eviction.MaxBuckets = 100000
+	}
+	return eviction
+}
+
+func newDistributed(cfg *config.Config) (*ratelimiter.Distributed, error) {
+	dcfg := cfg.RateLimit.Distributed
+	distributed := &ratelimiter.Distributed{
+		FailPolicy: dcfg.FailPolicy,
+		Timeout:    time.Duration(dcfg.TimeoutMs) * time.Millisecond,
+	}
+	switch dcfg.Mode {
+	case "":
+		return nil, nil
+	case "redis":
+		distributed.Store = ratelimiter.NewRedisStore(resp.Options{
+			Addr:        dcfg.RedisAddr,
+			Password:    dcfg.RedisPassword,
+			DB:          dcfg.RedisDB,
+			PoolSize:    dcfg.PoolSize,
+			DialTimeout: distributed.Timeout,
+		})
+	case "memory":
+		distributed.Store = ratelimiter.NewMemoryStore()
+	case "peers":
+		if cfg.AdminPort == "" {
+			return nil, fmt.Errorf("rate limit peer sync requires admin_port")
+		}
+		if err := ratelimiter.CheckPeers(dcfg.Peers, cfg.AdminPort); err != nil {
+			return nil, err
+		}
+		replica := dcfg.ReplicaID
+		if replica == "" {
+			host, _ := os.Hostname()
+			replica = host + ":" + cfg.Port
+		}
+		peers, err := ratelimiter.NewPeerStore(replica, dcfg.Peers, time.Duration(dcfg.SyncIntervalMs)*time.Millisecond, dcfg.PeerSecret)
+		if err != nil {
+			return nil, err
+		}
+		distributed.Store = peers
+	default:
+		return nil, fmt.Errorf("unknown rate limit distributed mode %q", dcfg.Mode)
+	}
+	return distributed, nil
+}
+
+func newStickySessions(cfg config.StickySessionsConfig) (*balancer.StickySessions, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	cookieName := cfg.CookieName
+	if cookieName == "" {
+		cookieName = "lb_affinity"
+	}
+	return balancer.NewStickySessions(cookieName, cfg.Secret, time.Duration(cfg.MaxAge)*time.Second)
+}
+
+// newProxyListener оборачивает listener основного порта в разбор PROXY protocol
+func newProxyListener(cfg config.ClientIPConfig, resolver *util.ClientIPResolver) func(net.Listener) net.Listener {
+	if !cfg.ProxyProtocol {
+		return nil
+	}
+	return func(ln net.Listener) net.Listener {
+		pl := &proxyproto.Listener{
+			Listener:      ln,
+			HeaderTimeout: time.Duration(cfg.ProxyHeaderTimeoutMs) * time.Millisecond,
+		}
+		if resolver.HasTrusted() {
+			pl.Trusted = resolver.Trusted
+		}
+		return pl
 	}
 }
 
 func (s *LoadBalancerServer) Start() error {
+	ln, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return err
+	}
+	if s.proxyListener != nil {
+		ln = s.proxyListener(ln)
+	}
+	s.serve(s.server, ln)
+
+	if s.adminServer != nil {
+		adminLn, err := net.Listen("tcp", s.adminServer.Addr)
+		if err != nil {
+			s.server.Close()
+			return err
+		}
+		s.serve(s.adminServer, adminLn)
+	}
+	return nil
+}
+
+func (s *LoadBalancerServer) serve(srv *http.Server, ln net.Listener) {
 	s.wg.Add(1)
 	go func() {
 		defer s.wg.Done()
-		if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
 			panic(err)
 		}
 	}()
-	return nil
 }
 
 func (s *LoadBalancerServer) Stop() error {
@@ -76,8 +541,21 @@ func (s *LoadBalancerServer) Stop() error {
 	if err := s.server.Shutdown(ctx); err != nil {
 		return err
 	}
+	if s.adminServer != nil {
+		if err := s.adminServer.Shutdown(ctx); err != nil {
+			return err
+		}
+	}
 	
 	s.healthChecker.Stop()
+	s.limiter.Close()
+	if s.limitStore != nil {
+		s.limitStore.Close()
+	}
+	s.transports.CloseIdleConnections()
 	s.wg.Wait()
+	if s.accessLog != nil {
+		return s.accessLog.Close()
+	}
 	return nil
 }
\ No newline at end of file
@@ -0,0 +1,110 @@
+package usecases
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+
+	"loadbalancer/internal/domain"
+	"loadbalancer/internal/interfaces/repositories"
+	util "loadbalancer/pkg/httputil"
+)
+
+type BackendManager struct {
+	repo       repositories.ServerRepository
+	transports *util.TransportPool
+}
+
+func NewBackendManager(repo repositories.ServerRepository, transports *util.TransportPool) *BackendManager {
+	return &BackendManager{repo: repo, transports: transports}
+}
+
+func (m *BackendManager) ListBackends() []*domain.Server {
+	return m.repo.GetAll()
+}
+
+// AddBackend добавляет бэкенд; вес 0 означает вес по умолчанию
+func (m *BackendManager) AddBackend(rawurl string, weight int) (*domain.Server, error) {
+	if weight < 0 {
+		return nil, errors.New("weight cannot be negative")
+	}
+	normalized, err := normalizeURL(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	server, err := domain.NewServer(normalized, weight)
+	if err != nil {
+		return nil, err
+	}
+	return m.repo.Add(server)
+}
+
+func (m *BackendManager) RemoveBackend(rawurl string) error {
+	normalized, err := normalizeURL(rawurl)
+	if err != nil {
+		return err
+	}
+	if err := m.repo.Remove(normalized); err != nil {
+		return err
+	}
+	if u, err := url.Parse(normalized); err == nil {
+		m.transports.Remove(u)
+	}
+	return nil
+}
+
+// ConnStats возвращает статистику пула соединений к бэкенду
+func (m *BackendManager) ConnStats(server *domain.Server) util.ConnStats {
+	return m.transports.Stats(server.URL)
+}
+
+func (m *BackendManager) EnableBackend(rawurl string) (*domain.Server, error) {
+	return m.setState(rawurl, domain.ServerActive)
+}
+
+func (m *BackendManager) DisableBackend(rawurl string) (*domain.Server, error) {
+	return m.setState(rawurl, domain.ServerDisabled)
+}
+
+// DrainBackend прекращает отправку новых запросов на бэкенд, не прерывая
+// текущие. Когда завершится последний из них, бэкенд становится disabled.
+func (m *BackendManager) DrainBackend(rawurl string) (*domain.Server, error) {
+	return m.setState(rawurl, domain.ServerDraining)
+}
+
+func (m *BackendManager) setState(rawurl, state string) (*domain.Server, error) {
+	normalized, err := normalizeURL(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	return m.repo.SetState(normalized, state)
+}
+
+func (m *BackendManager) UpdateWeight(rawurl string, weight int) (*domain.Server, error) {
+	if weight <= 0 {
+		return nil, errors.New("weight must be positive")
+	}
+	normalized, err := normalizeURL(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	return m.repo.SetWeight(normalized, weight)
+}
+
+// normalizeURL приводит URL бэкенда к виду, в котором он хранится в
+// репозитории: схема и хост в нижнем регистре, без завершающего "/"
+func normalizeURL(rawurl string) (string, error) {
+	if rawurl == "" {
+		return "", errors.New("backend URL cannot be empty")
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", errors.New("backend URL must be absolute")
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = ""
+	return u.String(), nil
+}
@@ -2,48 +2,132 @@ package usecases
 
 import (
 	"errors"
+	"fmt"
 
 	"loadbalancer/internal/domain"
 	"loadbalancer/internal/interfaces/repositories"
+	"loadbalancer/internal/ratelimiter"
 )
 
+// RateLimiter проверяет алгоритм клиентов и планов и возвращает текущий
+// расход квоты клиента
+type RateLimiter interface {
+	CheckAlgorithm(name string) error
+	QuotaUsage(client *domain.Client) domain.QuotaReport
+}
+
 type ClientManager struct {
-	repo repositories.ClientRepository
+	repo    repositories.ClientRepository
+	plans   repositories.PlanRepository
+	limiter RateLimiter
 }
 
-func NewClientManager(repo repositories.ClientRepository) *ClientManager {
-	return &ClientManager{repo: repo}
+func NewClientManager(repo repositories.ClientRepository, plans repositories.PlanRepository, limiter RateLimiter) *ClientManager {
+	return &ClientManager{repo: repo, plans: plans, limiter: limiter}
 }
 
-func (m *ClientManager) RegisterClient(id string, capacity, ratePerSec int) (*domain.Client, error) {
+// RegisterClient регистрирует клиента. Клиенту с планом capacity и
+// ratePerSec можно не задавать: нулевые поля берутся из плана.
+func (m *ClientManager) RegisterClient(id string, capacity, ratePerSec int, opts domain.ClientOptions) (*domain.Client, error) {
 	if id == "" {
 		return nil, errors.New("client ID cannot be empty")
 	}
-	if capacity <= 0 {
+	if opts.Plan == domain.NoPlan {
+		opts.Plan = ""
+	}
+	if err := m.checkPlan(opts.Plan); err != nil {
+		return nil, err
+	}
+	if capacity < 0 || capacity == 0 && opts.Plan == "" {
 		return nil, errors.New("capacity must be positive")
 	}
-	if ratePerSec <= 0 {
+	if ratePerSec < 0 || ratePerSec == 0 && opts.Plan == "" {
 		return nil, errors.New("rate must be positive")
 	}
+	if err := m.limiter.CheckAlgorithm(opts.Algorithm); err != nil {
+		return nil, err
+	}
+	if opts.MaxConcurrent < 0 {
+		return nil, errors.New("max concurrent requests cannot be negative")
+	}
+	if err := ratelimiter.ValidQuota(&opts.Quota); err != nil {
+		return nil, err
+	}
 
 	client := domain.NewClient(id, capacity, ratePerSec)
+	client.Plan = opts.Plan
+	client.Algorithm = opts.Algorithm
+	client.MaxConcurrent = opts.MaxConcurrent
+	client.Quota = opts.Quota
 	if err := m.repo.Save(client); err != nil {
 		return nil, err
 	}
 	return client, nil
 }
 
-func (m *ClientManager) UpdateClient(id string, capacity, ratePerSec int) (*domain.Client, error) {
+// UpdateClient меняет только переданные (ненулевые) поля. Отрицательные
+// capacity, ratePerSec и MaxConcurrent сбрасывают поле: клиент с планом
+// получает значение плана, без плана снимается ограничение одновременных
+// запросов. Отрицательный лимит квоты снимает квоту клиента. Не переданные
+// период и окно квоты остаются прежними. План domain.NoPlan снимает план:
+// тогда у клиента должны остаться собственные capacity и ratePerSec.
+func (m *ClientManager) UpdateClient(id string, capacity, ratePerSec int, opts domain.ClientOptions) (*domain.Client, error) {
+	if err := m.limiter.CheckAlgorithm(opts.Algorithm); err != nil {
+		return nil, err
+	}
+	if opts.Plan != domain.NoPlan {
+		if err := m.checkPlan(opts.Plan); err != nil {
+			return nil, err
+		}
+	}
 	client, err := m.repo.FindByID(id)
 	if err != nil {
 		return nil, err
 	}
 
-	if capacity > 0 {
-		client.Capacity = capacity
+	plan := client.Plan
+	switch opts.Plan {
+	case "":
+	case domain.NoPlan:
+		plan = ""
+	default:
+		plan = opts.Plan
+	}
+	newCapacity, newRate := updateField(client.Capacity, capacity), updateField(client.RatePerSec, ratePerSec)
+	if plan == "" && (newCapacity == 0 || newRate == 0) {
+		return nil, errors.New("capacity and rate are required for a client without a plan")
+	}
+
+	quota := client.Quota
+	if opts.Quota.Limit > 0 {
+		quota.Limit = opts.Quota.Limit
+	} else if opts.Quota.Limit < 0 {
+		quota = domain.Quota{}
+	}
+	if quota.Limit > 0 {
+		if opts.Quota.Period != "" {
+			quota.Period = opts.Quota.Period
+		}
+		if opts.Quota.Window != "" {
+			quota.Window = opts.Quota.Window
+		}
+	}
+	if err := ratelimiter.ValidQuota(&quota); err != nil {
+		return nil, err
+	}
+
+	client.Plan = plan
+	client.Capacity = newCapacity
+	client.RatePerSec = newRate
+	if opts.Algorithm != "" {
+		client.Algorithm = opts.Algorithm
 	}
-	if ratePerSec > 0 {
-		client.RatePerSec = ratePerSec
+	client.MaxConcurrent = updateField(client.MaxConcurrent, opts.MaxConcurrent)
+	if quota != client.Quota {
+		if quota.Period != client.Quota.Period || quota.Window != client.Quota.Window {
+			client.Usage = domain.QuotaUsage{}
+		}
+		client.Quota = quota
 	}
 
 	if err := m.repo.Save(client); err != nil {
@@ -52,6 +136,40 @@ func (m *ClientManager) UpdateClient(id string, capacity, ratePerSec int) (*doma
 	return client, nil
 }
 
+// updateField возвращает новое значение числового поля: 0 — не менять,
+// отрицательное — сбросить
+func updateField(current, update int) int {
+	switch {
+	case update > 0:
+		return update
+	case update < 0:
+		return 0
+	default:
+		return current
+	}
+}
+
+// checkPlan проверяет, что план, на который ссылается клиент, существует
+func (m *ClientManager) checkPlan(name string) error {
+	if name == "" {
+		return nil
+	}
+	if _, err := m.plans.FindByName(name); err != nil {
+		return fmt.Errorf("plan %s: %w", name, err)
+	}
+	return nil
+}
+
+// GetUsage возвращает текущий расход квоты клиента
+func (m *ClientManager) GetUsage(id string) (*domain.QuotaReport, error) {
+	client, err := m.repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	report := m.limiter.QuotaUsage(client)
+	return &report, nil
+}
+
 func (m *ClientManager) DeleteClient(id string) error {
 	return m.repo.Delete(id)
 }
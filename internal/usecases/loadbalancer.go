@@ -1,24 +1,54 @@
 package usecases
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"net/http/httputil"
+	"net/url"
+	"strconv"
 	"time"
 
+	"loadbalancer/internal/accesslog"
+	"loadbalancer/internal/balancer"
+	"loadbalancer/internal/breaker"
+	"loadbalancer/internal/domain"
 	"loadbalancer/internal/interfaces/repositories"
+	"loadbalancer/internal/metrics"
+	"loadbalancer/internal/retry"
 	util "loadbalancer/pkg/httputil"
 )
 
 type LoadBalancer struct {
 	serverRepo    repositories.ServerRepository
 	healthChecker util.HealthChecker
+	keyFunc       balancer.KeyFunc
+	sticky        *balancer.StickySessions // nil, если привязка сессий выключена
+	retryPolicy   retry.Policy
+	retryBudget   *retry.Budget
+	transports    *util.TransportPool
 }
 
-func NewLoadBalancer(repo repositories.ServerRepository, checker util.HealthChecker) *LoadBalancer {
+func NewLoadBalancer(
+	repo repositories.ServerRepository,
+	checker util.HealthChecker,
+	keyFunc balancer.KeyFunc,
+	sticky *balancer.StickySessions,
+	retryPolicy retry.Policy,
+	retryBudget *retry.Budget,
+	transports *util.TransportPool,
+) *LoadBalancer {
 	lb := &LoadBalancer{
 		serverRepo:    repo,
 		healthChecker: checker,
+		keyFunc:       keyFunc,
+		sticky:        sticky,
+		retryPolicy:   retryPolicy,
+		retryBudget:   retryBudget,
+		transports:    transports,
 	}
 
 	// Запуск фоновой проверки здоровья
@@ -27,46 +57,216 @@ func NewLoadBalancer(repo repositories.ServerRepository, checker util.HealthChec
 	return lb
 }
 
+// monitorHealth проверяет здоровье серверов, пока не будет вызван HealthChecker.Stop
 func (lb *LoadBalancer) monitorHealth() {
-	ticker := time.NewTicker(3 * time.Second) // Каждые 3 секунды проверяем здоровье
-	defer ticker.Stop()
+	timer := time.NewTimer(lb.healthChecker.NextInterval())
+	defer timer.Stop()
 
 	for {
-		<-ticker.C
-		lb.checkAllServers()
+		select {
+		case <-lb.healthChecker.Done():
+			return
+		case <-timer.C:
+			lb.checkAllServers()
+			timer.Reset(lb.healthChecker.NextInterval())
+		}
 	}
 }
 
 func (lb *LoadBalancer) checkAllServers() {
 	servers := lb.serverRepo.GetAll()
 
+	urls := make([]*url.URL, 0, len(servers))
+	byURL := make(map[*url.URL]*domain.Server, len(servers))
 	for _, server := range servers {
-		isHealthy := lb.healthChecker.Check(server.URL)
-		lb.serverRepo.UpdateHealth(server, isHealthy)
+		urls = append(urls, server.URL)
+		byURL[server.URL] = server
 	}
+
+	lb.healthChecker.CheckAll(urls, func(u *url.URL, healthy bool) {
+		lb.serverRepo.UpdateHealth(byURL[u], healthy)
+	})
+}
+
+// selected — бэкенд, выбранный для попытки, и поколение его circuit breaker
+type selected struct {
+	server     *domain.Server
+	generation uint64
+	// pinned — запрос пришел с валидной cookie привязки к этому бэкенду
+	pinned bool
+}
+
+// selectServer выбирает бэкенд для запроса: по cookie привязки, если она
+// указывает на доступный бэкенд, иначе стратегией балансировки
+func (lb *LoadBalancer) selectServer(r *http.Request, sel balancer.Selection) (selected, error) {
+	if lb.sticky != nil {
+		if rawurl, ok := lb.sticky.Backend(r); ok && !sel.Exclude[rawurl] {
+			if server, generation, err := lb.serverRepo.Get(rawurl); err == nil {
+				return selected{server: server, generation: generation, pinned: true}, nil
+			}
+		}
+	}
+
+	server, generation, err := lb.serverRepo.GetNext(sel)
+	return selected{server: server, generation: generation}, err
 }
 
 func (lb *LoadBalancer) HandleRequest(w http.ResponseWriter, r *http.Request) {
-	server, err := lb.serverRepo.GetNext()
-	if err != nil || server == nil {
-		log.Printf("All backend servers are unavailable")
-		http.Error(w, "All backend servers are unavailable", http.StatusServiceUnavailable)
-		return
+	metrics.InFlight.With().Inc()
+	defer metrics.InFlight.With().Dec()
+
+	// Тело буферизуется, только если запрос можно повторить: иначе оно
+	// передается бэкенду потоком
+	attempts := lb.retryPolicy.Attempts(r.Method)
+	body := &retry.Body{}
+	if attempts > 1 {
+		var err error
+		body, err = retry.BufferBody(r, lb.retryPolicy.MaxBodyBytes)
+		if err != nil {
+			http.Error(w, "Failed to read request body", http.StatusBadRequest)
+			return
+		}
+		if !body.Replayable() {
+			attempts = 1
+		}
+	}
+	lb.retryBudget.RecordRequest()
+
+	entry := accesslog.FromContext(r.Context())
+	sel := balancer.Selection{Key: lb.keyFunc(r), Exclude: make(map[string]bool)}
+	for attempt := 1; ; attempt++ {
+		target, err := lb.selectServer(r, sel)
+		if err != nil || target.server == nil {
+			log.Printf("All backend servers are unavailable")
+			http.Error(w, "All backend servers are unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		server := target.server
+
+		body.Rewind(r)
+		last := attempt >= attempts
+		entry.Backend = server.URL.String()
+		entry.Retries = attempt - 1
+		failure := lb.proxy(w, r, target, last)
+		if failure == nil || r.Context().Err() != nil {
+			return
+		}
+
+		// Повтор никогда не уходит на бэкенд, который только что не ответил
+		sel.Exclude[server.URL.String()] = true
+		if last || !lb.retryPolicy.Retryable(failure) || !lb.retryBudget.Withdraw() {
+			if failure.Timeout {
+				http.Error(w, "Gateway timeout", http.StatusGatewayTimeout)
+			} else {
+				http.Error(w, "Bad gateway", http.StatusBadGateway)
+			}
+			return
+		}
+
+		metrics.Retries.With(server.URL.String()).Inc()
+		log.Printf("Retrying request %s %s after %s from %s (attempt %d of %d)",
+			r.Method, r.URL.Path, failure.Reason, server.URL.String(), attempt+1, attempts)
+		select {
+		case <-time.After(lb.retryPolicy.BackoffFor(attempt)):
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// proxy выполняет одну попытку проксирования запроса на сервер. Если попытка
+// не удалась и клиенту еще ничего не отправлено, возвращается retry.Failure.
+// На последней попытке ответ бэкенда передается клиенту при любом коде.
+func (lb *LoadBalancer) proxy(w http.ResponseWriter, r *http.Request, target selected, last bool) *retry.Failure {
+	server := target.server
+	var failure *retry.Failure
+	code := "error"
+
+	// Результат сообщается circuit breaker-у ровно один раз
+	reported := false
+	report := func(outcome breaker.Outcome, reason string) {
+		reported = true
+		lb.serverRepo.ReportResult(server, target.generation, outcome, reason)
 	}
 
+	start := time.Now()
 	proxy := &httputil.ReverseProxy{
+		Transport: lb.transports.Get(server.URL),
 		Director: func(req *http.Request) {
 			req.URL.Scheme = server.URL.Scheme
 			req.URL.Host = server.URL.Host
 			req.Host = server.URL.Host
 		},
+		ModifyResponse: func(resp *http.Response) error {
+			// Время до получения заголовков ответа — задержка бэкенда
+			lb.serverRepo.ObserveLatency(server, time.Since(start))
+			code = strconv.Itoa(resp.StatusCode)
+
+			// В circuit breaker ошибкой считаются только 5xx, а повторить
+			// можно любой код из политики, например 429
+			reason := fmt.Sprintf("status %d", resp.StatusCode)
+			if resp.StatusCode >= http.StatusInternalServerError {
+				report(breaker.Failure, reason)
+			} else {
+				report(breaker.Success, "")
+			}
+			if !last && lb.retryPolicy.RetryStatus(resp.StatusCode) {
+				failure = &retry.Failure{Status: resp.StatusCode, Reason: reason}
+				return failure
+			}
+
+			// Закрепляем клиента за бэкендом, только когда тот ответил
+			if lb.sticky != nil && !target.pinned {
+				resp.Header.Add("Set-Cookie", lb.sticky.Cookie(server.URL.String()).String())
+			}
+			return nil
+		},
 		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			if failure != nil {
+				// Ответ с кодом для повтора, результат уже учтен в ModifyResponse
+				return
+			}
+			if r.Context().Err() != nil {
+				// Клиент отменил запрос — бэкенд в этом не виноват
+				report(breaker.Ignored, "")
+				failure = &retry.Failure{Reason: "client canceled"}
+				return
+			}
+
 			log.Printf("Connection to %s failed: %v", server.URL.String(), err)
-			lb.serverRepo.MarkUnhealthy(server)
-			lb.HandleRequest(w, r) // Пробуем другой сервер
+			failure = newFailure(err)
+			report(breaker.Failure, failure.Reason)
 		},
 	}
 
-	log.Printf("Proxying request to %s", server.URL.String())
+	backend := server.URL.String()
+	lb.serverRepo.Acquire(server)
+	metrics.BackendInFlight.With(backend).Inc()
+	defer func() {
+		// Если ReverseProxy прервал ответ паникой http.ErrAbortHandler до
+		// того, как результат был учтен, пробный слот half-open освобождается
+		if !reported {
+			report(breaker.Ignored, "")
+		}
+		lb.serverRepo.Release(server)
+		metrics.BackendInFlight.With(backend).Dec()
+	}()
+
+	log.Printf("Proxying request to %s", backend)
 	proxy.ServeHTTP(w, r)
+
+	elapsed := time.Since(start)
+	accesslog.FromContext(r.Context()).UpstreamDuration += elapsed
+	metrics.Requests.With(backend, code).Inc()
+	metrics.RequestDuration.With(backend, code).Observe(elapsed.Seconds())
+	return failure
+}
+
+// newFailure классифицирует ошибку проксирования
+func newFailure(err error) *retry.Failure {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return &retry.Failure{Timeout: true, Reason: "timeout"}
+	}
+	return &retry.Failure{Reason: "connection error"}
 }
@@ -0,0 +1,73 @@
+package usecases
+
+import (
+	"errors"
+	"fmt"
+
+	"loadbalancer/internal/domain"
+	"loadbalancer/internal/interfaces/repositories"
+	"loadbalancer/internal/ratelimiter"
+)
+
+type PlanManager struct {
+	repo    repositories.PlanRepository
+	clients repositories.ClientRepository
+	limiter RateLimiter
+}
+
+func NewPlanManager(repo repositories.PlanRepository, clients repositories.ClientRepository, limiter RateLimiter) *PlanManager {
+	return &PlanManager{repo: repo, clients: clients, limiter: limiter}
+}
+
+// SavePlan создает или заменяет план. Новые лимиты сразу применяются ко
+// всем клиентам плана.
+func (m *PlanManager) SavePlan(plan *domain.Plan) error {
+	if plan.Name == "" {
+		return errors.New("plan name cannot be empty")
+	}
+	if plan.Name == domain.NoPlan {
+		return fmt.Errorf("plan name %q is reserved", domain.NoPlan)
+	}
+	if plan.Capacity <= 0 {
+		return errors.New("capacity must be positive")
+	}
+	if plan.RatePerSec <= 0 {
+		return errors.New("rate must be positive")
+	}
+	if err := m.limiter.CheckAlgorithm(plan.Algorithm); err != nil {
+		return err
+	}
+	if plan.MaxConcurrent < 0 {
+		return errors.New("max concurrent requests cannot be negative")
+	}
+	if err := ratelimiter.ValidQuota(&plan.Quota); err != nil {
+		return err
+	}
+	return m.repo.Save(plan)
+}
+
+// DeletePlan удаляет план, если на него не ссылается ни один клиент
+func (m *PlanManager) DeletePlan(name string) error {
+	clients, err := m.clients.FindAll()
+	if err != nil {
+		return err
+	}
+	used := 0
+	for _, client := range clients {
+		if client.Plan == name {
+			used++
+		}
+	}
+	if used > 0 {
+		return fmt.Errorf("plan %s is used by %d clients", name, used)
+	}
+	return m.repo.Delete(name)
+}
+
+func (m *PlanManager) GetPlan(name string) (*domain.Plan, error) {
+	return m.repo.FindByName(name)
+}
+
+func (m *PlanManager) ListPlans() ([]*domain.Plan, error) {
+	return m.repo.FindAll()
+}
@@ -1,39 +1,172 @@
 package httputil
 
 import (
+	"context"
+	"io"
+	"math/rand"
 	"net/http"
 	"net/url"
+	"sync"
 	"time"
 )
 
 type HealthChecker interface {
     Check(*url.URL) bool 
+    CheckAll(urls []*url.URL, report func(u *url.URL, healthy bool))
+    SetProbe(rawurl string, probe Probe)
+    NextInterval() time.Duration
+    Done() <-chan struct{}
     Stop()
 }
 
+const (
+	DefaultCheckInterval    = 3 * time.Second
+	DefaultCheckConcurrency = 8
+)
+
+// Schedule задает периодичность проверок: Interval ± случайный Jitter между
+// раундами и не более Concurrency одновременных проверок в раунде.
+type Schedule struct {
+	Interval    time.Duration
+	Jitter      time.Duration
+	Concurrency int
+}
+
 type healthChecker struct {
-    interval time.Duration
-    stopChan chan struct{}
+    schedule     Schedule
+    defaultProbe Probe
+    probes       map[string]Probe
+    client       *http.Client
+    mu           sync.RWMutex
+    stopChan     chan struct{}
+    stopOnce     sync.Once
 }
 
-func NewHealthChecker(interval time.Duration) HealthChecker {
+func NewHealthChecker(schedule Schedule, defaultProbe Probe) HealthChecker {
+    if schedule.Interval <= 0 {
+        schedule.Interval = DefaultCheckInterval
+    }
+    if schedule.Concurrency <= 0 {
+        schedule.Concurrency = DefaultCheckConcurrency
+    }
     return &healthChecker{
-        interval: interval,
-        stopChan: make(chan struct{}),
+        schedule:     schedule,
+        defaultProbe: defaultProbe,
+        probes:       make(map[string]Probe),
+        // Таймаут задается для каждой проверки через context
+        client:       &http.Client{},
+        stopChan:     make(chan struct{}),
     }
 }
 
+// NextInterval возвращает паузу до следующего раунда проверок с учетом jitter,
+// чтобы проверки нескольких балансировщиков не совпадали по времени
+func (h *healthChecker) NextInterval() time.Duration {
+	if h.schedule.Jitter <= 0 {
+		return h.schedule.Interval
+	}
+	jitter := time.Duration(rand.Int63n(int64(2*h.schedule.Jitter))) - h.schedule.Jitter
+	if interval := h.schedule.Interval + jitter; interval > 0 {
+		return interval
+	}
+	return h.schedule.Interval
+}
+
+// Done закрывается при остановке проверки здоровья
+func (h *healthChecker) Done() <-chan struct{} {
+	return h.stopChan
+}
+
+// CheckAll проверяет серверы параллельно, не более Concurrency одновременно,
+// и сообщает результат каждой проверки в report
+func (h *healthChecker) CheckAll(urls []*url.URL, report func(u *url.URL, healthy bool)) {
+	jobs := make(chan *url.URL)
+	var wg sync.WaitGroup
+
+	workers := min(h.schedule.Concurrency, len(urls))
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for u := range jobs {
+				report(u, h.Check(u))
+			}
+		}()
+	}
+
+	for _, u := range urls {
+		select {
+		case jobs <- u:
+		case <-h.stopChan:
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// SetProbe задает отдельную проверку для бэкенда
+func (h *healthChecker) SetProbe(rawurl string, probe Probe) {
+	if u, err := url.Parse(rawurl); err == nil {
+		rawurl = u.String()
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.probes[rawurl] = probe
+}
+
+func (h *healthChecker) probeFor(u *url.URL) Probe {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if probe, ok := h.probes[u.String()]; ok {
+		return probe
+	}
+	return h.defaultProbe
+}
+
 // Check выполняет проверку здоровья сервера
 func (h *healthChecker) Check(u *url.URL) bool {
-	client := http.Client{Timeout: http.DefaultClient.Timeout}
-	resp, err := client.Get(u.String() + "/health")
+	probe := h.probeFor(u)
+
+	timeout := probe.Timeout
+	if timeout <= 0 {
+		timeout = DefaultProbeTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, probe.Method, u.String()+probe.Path, nil)
+	if err != nil {
+		return false
+	}
+	for name, value := range probe.Headers {
+		if http.CanonicalHeaderKey(name) == "Host" {
+			req.Host = value
+			continue
+		}
+		req.Header.Set(name, value)
+	}
+
+	resp, err := h.client.Do(req)
 	if err != nil {
 		return false
 	}
 	defer resp.Body.Close()
-	return resp.StatusCode == http.StatusOK
+
+	if !probe.acceptsStatus(resp.StatusCode) {
+		return false
+	}
+	if probe.BodyContains == "" && probe.BodyRegex == nil {
+		return true
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxProbeBody))
+	if err != nil {
+		return false
+	}
+	return probe.matchesBody(body)
 }
 
 func (h *healthChecker) Stop() {
-    close(h.stopChan)
-}
\ No newline at end of file
+    h.stopOnce.Do(func() { close(h.stopChan) })
+}
@@ -0,0 +1,84 @@
+package httputil
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultProbePath    = "/health"
+	DefaultProbeTimeout = 2 * time.Second
+
+	// maxProbeBody — сколько байт тела ответа читается для проверки содержимого
+	maxProbeBody = 64 << 10
+)
+
+// StatusRange — диапазон допустимых кодов ответа, включительно
+type StatusRange struct {
+	Min, Max int
+}
+
+// Probe описывает проверку здоровья бэкенда
+type Probe struct {
+	Path           string
+	Method         string
+	Headers        map[string]string
+	ExpectedStatus []StatusRange
+	BodyContains   string
+	BodyRegex      *regexp.Regexp
+	Timeout        time.Duration
+}
+
+// DefaultProbe — GET /health, ожидается 200 OK
+func DefaultProbe() Probe {
+	return Probe{
+		Path:           DefaultProbePath,
+		Method:         http.MethodGet,
+		ExpectedStatus: []StatusRange{{http.StatusOK, http.StatusOK}},
+		Timeout:        DefaultProbeTimeout,
+	}
+}
+
+// ParseStatusRanges разбирает коды ответа вида "200", "204" или "200-299"
+func ParseStatusRanges(specs []string) ([]StatusRange, error) {
+	ranges := make([]StatusRange, 0, len(specs))
+	for _, spec := range specs {
+		lo, hi, isRange := strings.Cut(strings.TrimSpace(spec), "-")
+		if !isRange {
+			hi = lo
+		}
+		min, err := strconv.Atoi(strings.TrimSpace(lo))
+		if err != nil {
+			return nil, fmt.Errorf("invalid status %q", spec)
+		}
+		max, err := strconv.Atoi(strings.TrimSpace(hi))
+		if err != nil || max < min {
+			return nil, fmt.Errorf("invalid status range %q", spec)
+		}
+		ranges = append(ranges, StatusRange{min, max})
+	}
+	return ranges, nil
+}
+
+func (p *Probe) acceptsStatus(code int) bool {
+	for _, r := range p.ExpectedStatus {
+		if code >= r.Min && code <= r.Max {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Probe) matchesBody(body []byte) bool {
+	if p.BodyContains != "" && !strings.Contains(string(body), p.BodyContains) {
+		return false
+	}
+	if p.BodyRegex != nil && !p.BodyRegex.Match(body) {
+		return false
+	}
+	return true
+}
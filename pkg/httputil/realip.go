@@ -0,0 +1,175 @@
+package httputil
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Заголовки, из которых берется адрес клиента за доверенным прокси
+const (
+	HeaderForwarded     = "Forwarded"
+	HeaderXForwardedFor = "X-Forwarded-For"
+)
+
+type clientIPKey struct{}
+
+// ClientIPResolver определяет реальный IP клиента. Заголовкам Forwarded и
+// X-Forwarded-For верим, только если соединение пришло от доверенного прокси.
+type ClientIPResolver struct {
+	trusted []*net.IPNet
+	headers []string
+}
+
+// NewClientIPResolver принимает доверенные сети в виде CIDR или отдельных
+// адресов и заголовки в порядке приоритета. По умолчанию — сначала Forwarded
+// (RFC 7239), затем X-Forwarded-For.
+func NewClientIPResolver(trustedProxies, headers []string) (*ClientIPResolver, error) {
+	res := &ClientIPResolver{headers: headers}
+	if len(res.headers) == 0 {
+		res.headers = []string{HeaderForwarded, HeaderXForwardedFor}
+	}
+	for _, header := range res.headers {
+		header = http.CanonicalHeaderKey(header)
+		if header != HeaderForwarded && header != HeaderXForwardedFor {
+			return nil, fmt.Errorf("unsupported client IP header %q", header)
+		}
+	}
+
+	for _, proxy := range trustedProxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			res.trusted = append(res.trusted, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		res.trusted = append(res.trusted, network)
+	}
+	return res, nil
+}
+
+// Trusted сообщает, входит ли адрес в доверенные сети
+func (res *ClientIPResolver) Trusted(ip net.IP) bool {
+	for _, network := range res.trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasTrusted сообщает, задана ли хотя бы одна доверенная сеть
+func (res *ClientIPResolver) HasTrusted() bool {
+	return len(res.trusted) > 0
+}
+
+// Resolve возвращает IP клиента. Цепочка адресов из заголовка проходится
+// справа налево, пока адреса доверенные: первый недоверенный и есть клиент.
+// Если доверенные все, клиентом считается самый левый адрес.
+func (res *ClientIPResolver) Resolve(r *http.Request) net.IP {
+	peer := parseHost(r.RemoteAddr)
+	if peer == nil || !res.Trusted(peer) {
+		return peer
+	}
+
+	for _, header := range res.headers {
+		var chain []string
+		if http.CanonicalHeaderKey(header) == HeaderForwarded {
+			chain = forwardedFor(r.Header.Values(HeaderForwarded))
+		} else {
+			chain = splitList(r.Header.Values(HeaderXForwardedFor))
+		}
+		if len(chain) == 0 {
+			continue
+		}
+
+		client := peer
+		for i := len(chain) - 1; i >= 0; i-- {
+			ip := parseHost(chain[i])
+			if ip == nil {
+				// "unknown" или скрытый идентификатор — дальше цепочке не верим
+				break
+			}
+			client = ip
+			if !res.Trusted(ip) {
+				break
+			}
+		}
+		return client
+	}
+	return peer
+}
+
+// Middleware сохраняет IP клиента в контексте запроса, откуда его берет ClientIP
+func (res *ClientIPResolver) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ip := res.Resolve(r); ip != nil {
+			r = r.WithContext(context.WithValue(r.Context(), clientIPKey{}, ip.String()))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ClientIP возвращает IP клиента, определенный Middleware, или адрес из
+// RemoteAddr, если запрос не проходил через Middleware
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// parseHost разбирает адрес с портом или без, в том числе "[::1]:80"
+func parseHost(addr string) net.IP {
+	addr = strings.TrimSpace(addr)
+	if ip := net.ParseIP(addr); ip != nil {
+		return ip
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return net.ParseIP(host)
+	}
+	return net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]"))
+}
+
+func splitList(values []string) []string {
+	var list []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
+
+// forwardedFor достает параметры for= из элементов заголовка Forwarded
+func forwardedFor(values []string) []string {
+	var list []string
+	for _, element := range splitList(values) {
+		for _, pair := range strings.Split(element, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok || !strings.EqualFold(key, "for") {
+				continue
+			}
+			list = append(list, strings.Trim(value, `"`))
+		}
+	}
+	return list
+}
@@ -0,0 +1,210 @@
+package httputil
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewClientIPResolver(t *testing.T) {
+	tests := []struct {
+		name    string
+		trusted []string
+		headers []string
+		err     bool
+	}{
+		{name: "defaults"},
+		{name: "cidr and addresses", trusted: []string{"10.0.0.0/8", "192.0.2.1", "2001:db8::/32", "::1"}},
+		{name: "header case ignored", headers: []string{"x-forwarded-for", "forwarded"}},
+		{name: "unsupported header", headers: []string{"X-Real-IP"}, err: true},
+		{name: "bad address", trusted: []string{"10.0.0"}, err: true},
+		{name: "bad cidr", trusted: []string{"10.0.0.0/33"}, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewClientIPResolver(tt.trusted, tt.headers)
+			if (err != nil) != tt.err {
+				t.Fatalf("err = %v, want error %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestClientIPResolverResolve(t *testing.T) {
+	trusted := []string{"10.0.0.0/8", "192.0.2.1", "2001:db8::/32"}
+	tests := []struct {
+		name    string
+		headers []string
+		remote  string
+		request http.Header
+		want    string
+	}{
+		{
+			name:    "untrusted peer ignores headers",
+			remote:  "203.0.113.5:4000",
+			request: http.Header{"X-Forwarded-For": {"198.51.100.1"}},
+			want:    "203.0.113.5",
+		},
+		{
+			name:   "trusted peer without headers",
+			remote: "10.1.1.1:4000",
+			want:   "10.1.1.1",
+		},
+		{
+			name:    "xff single hop",
+			remote:  "10.1.1.1:4000",
+			request: http.Header{"X-Forwarded-For": {"198.51.100.1"}},
+			want:    "198.51.100.1",
+		},
+		{
+			name:    "xff skips trusted hops from the right",
+			remote:  "10.1.1.1:4000",
+			request: http.Header{"X-Forwarded-For": {"198.51.100.1, 203.0.113.9, 10.2.2.2", "192.0.2.1"}},
+			want:    "203.0.113.9",
+		},
+		{
+			name:    "xff spoofed left part is not trusted",
+			remote:  "192.0.2.1:4000",
+			request: http.Header{"X-Forwarded-For": {"1.1.1.1, 203.0.113.9"}},
+			want:    "203.0.113.9",
+		},
+		{
+			name:    "xff all trusted takes leftmost",
+			remote:  "10.1.1.1:4000",
+			request: http.Header{"X-Forwarded-For": {"10.3.3.3, 10.2.2.2"}},
+			want:    "10.3.3.3",
+		},
+		{
+			name:    "xff garbage stops the walk",
+			remote:  "10.1.1.1:4000",
+			request: http.Header{"X-Forwarded-For": {"198.51.100.1, garbage, 10.2.2.2"}},
+			want:    "10.2.2.2",
+		},
+		{
+			name:    "xff only garbage keeps peer",
+			remote:  "10.1.1.1:4000",
+			request: http.Header{"X-Forwarded-For": {"garbage"}},
+			want:    "10.1.1.1",
+		},
+		{
+			name:    "forwarded for",
+			remote:  "10.1.1.1:4000",
+			request: http.Header{"Forwarded": {`for=198.51.100.1;proto=https;by=10.1.1.1`}},
+			want:    "198.51.100.1",
+		},
+		{
+			name:    "forwarded quoted ipv6 with port",
+			remote:  "10.1.1.1:4000",
+			request: http.Header{"Forwarded": {`for="[2001:db9::7]:4711"`}},
+			want:    "2001:db9::7",
+		},
+		{
+			name:    "forwarded chain and key case",
+			remote:  "10.1.1.1:4000",
+			request: http.Header{"Forwarded": {`For=198.51.100.1, for=10.2.2.2`}},
+			want:    "198.51.100.1",
+		},
+		{
+			name:    "forwarded unknown hides the client",
+			remote:  "10.1.1.1:4000",
+			request: http.Header{"Forwarded": {`for=198.51.100.1, for=unknown`}},
+			want:    "10.1.1.1",
+		},
+		{
+			name:    "forwarded obfuscated identifier after trusted hop",
+			remote:  "10.1.1.1:4000",
+			request: http.Header{"Forwarded": {`for=_hidden, for=10.2.2.2`}},
+			want:    "10.2.2.2",
+		},
+		{
+			name:   "forwarded preferred over xff by default",
+			remote: "10.1.1.1:4000",
+			request: http.Header{
+				"Forwarded":       {"for=198.51.100.1"},
+				"X-Forwarded-For": {"198.51.100.2"},
+			},
+			want: "198.51.100.1",
+		},
+		{
+			name:    "configured header order",
+			headers: []string{"X-Forwarded-For", "Forwarded"},
+			remote:  "10.1.1.1:4000",
+			request: http.Header{
+				"Forwarded":       {"for=198.51.100.1"},
+				"X-Forwarded-For": {"198.51.100.2"},
+			},
+			want: "198.51.100.2",
+		},
+		{
+			name:    "falls back to next header",
+			remote:  "10.1.1.1:4000",
+			request: http.Header{"X-Forwarded-For": {"198.51.100.2"}},
+			want:    "198.51.100.2",
+		},
+		{
+			name:    "forwarded without for falls back to xff",
+			remote:  "10.1.1.1:4000",
+			request: http.Header{"Forwarded": {"proto=https"}, "X-Forwarded-For": {"198.51.100.2"}},
+			want:    "198.51.100.2",
+		},
+		{
+			name:    "ipv6 trusted peer",
+			remote:  "[2001:db8::1]:4000",
+			request: http.Header{"X-Forwarded-For": {"198.51.100.1"}},
+			want:    "198.51.100.1",
+		},
+		{
+			name:    "disabled header is ignored",
+			headers: []string{"Forwarded"},
+			remote:  "10.1.1.1:4000",
+			request: http.Header{"X-Forwarded-For": {"198.51.100.2"}},
+			want:    "10.1.1.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := NewClientIPResolver(trusted, tt.headers)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remote
+			for key, values := range tt.request {
+				r.Header[key] = values
+			}
+
+			if got := res.Resolve(r).String(); got != tt.want {
+				t.Errorf("Resolve = %s, want %s", got, tt.want)
+			}
+
+			var seen string
+			res.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = ClientIP(r)
+			})).ServeHTTP(httptest.NewRecorder(), r)
+			if seen != tt.want {
+				t.Errorf("ClientIP after Middleware = %s, want %s", seen, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientIPWithoutMiddleware(t *testing.T) {
+	tests := []struct {
+		remote string
+		want   string
+	}{
+		{remote: "203.0.113.5:4000", want: "203.0.113.5"},
+		{remote: "[2001:db8::1]:80", want: "2001:db8::1"},
+		{remote: "pipe", want: "pipe"},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tt.remote
+		if got := ClientIP(r); got != tt.want {
+			t.Errorf("ClientIP(%q) = %s, want %s", tt.remote, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package httputil
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TransportSettings — настройки пула соединений к бэкенду
+type TransportSettings struct {
+	MaxIdleConns          int
+	MaxIdleConnsPerHost   int
+	MaxConnsPerHost       int
+	IdleConnTimeout       time.Duration
+	DialTimeout           time.Duration
+	KeepAlive             time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	ExpectContinueTimeout time.Duration
+	HTTP2                 bool
+}
+
+// ConnStats — статистика пула соединений к бэкенду
+type ConnStats struct {
+	Open       int64 // открытые соединения
+	Dials      int64 // всего установлено соединений
+	DialErrors int64 // неудачные попытки соединения
+	Requests   int64 // всего запросов
+	Reused     int64 // запросы, отправленные по уже открытому соединению
+}
+
+type backendTransport struct {
+	transport *http.Transport
+	stats     ConnStats
+}
+
+// RoundTrip отправляет запрос и учитывает, было ли соединение переиспользовано
+func (t *backendTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt64(&t.stats.Requests, 1)
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				atomic.AddInt64(&t.stats.Reused, 1)
+			}
+		},
+	}
+	return t.transport.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+}
+
+func (t *backendTransport) dial(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			atomic.AddInt64(&t.stats.DialErrors, 1)
+			return nil, err
+		}
+		atomic.AddInt64(&t.stats.Dials, 1)
+		atomic.AddInt64(&t.stats.Open, 1)
+		return &countedConn{Conn: conn, open: &t.stats.Open}, nil
+	}
+}
+
+// countedConn уменьшает счетчик открытых соединений при закрытии
+type countedConn struct {
+	net.Conn
+	open   *int64
+	closed int32
+}
+
+func (c *countedConn) Close() error {
+	if atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
+		atomic.AddInt64(c.open, -1)
+	}
+	return c.Conn.Close()
+}
+
+// TransportPool хранит долгоживущий http.Transport для каждого бэкенда,
+// чтобы соединения переиспользовались между запросами
+type TransportPool struct {
+	settings   TransportSettings
+	transports map[string]*backendTransport
+	mu         sync.Mutex
+}
+
+func NewTransportPool(settings TransportSettings) *TransportPool {
+	return &TransportPool{
+		settings:   settings,
+		transports: make(map[string]*backendTransport),
+	}
+}
+
+// Get возвращает транспорт бэкенда, создавая его при первом обращении
+func (p *TransportPool) Get(u *url.URL) http.RoundTripper {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := u.Scheme + "://" + u.Host
+	if t, ok := p.transports[key]; ok {
+		return t
+	}
+
+	t := &backendTransport{}
+	dialer := &net.Dialer{
+		Timeout:   p.settings.DialTimeout,
+		KeepAlive: p.settings.KeepAlive,
+	}
+	t.transport = &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           t.dial(dialer),
+		MaxIdleConns:          p.settings.MaxIdleConns,
+		MaxIdleConnsPerHost:   p.settings.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       p.settings.MaxConnsPerHost,
+		IdleConnTimeout:       p.settings.IdleConnTimeout,
+		TLSHandshakeTimeout:   p.settings.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: p.settings.ResponseHeaderTimeout,
+		ExpectContinueTimeout: p.settings.ExpectContinueTimeout,
+		ForceAttemptHTTP2:     p.settings.HTTP2,
+		DisableKeepAlives:     p.settings.KeepAlive < 0,
+	}
+	p.transports[key] = t
+	return t
+}
+
+// Stats возвращает статистику пула соединений бэкенда
+func (p *TransportPool) Stats(u *url.URL) ConnStats {
+	p.mu.Lock()
+	t, ok := p.transports[u.Scheme+"://"+u.Host]
+	p.mu.Unlock()
+	if !ok {
+		return ConnStats{}
+	}
+
+	return ConnStats{
+		Open:       atomic.LoadInt64(&t.stats.Open),
+		Dials:      atomic.LoadInt64(&t.stats.Dials),
+		DialErrors: atomic.LoadInt64(&t.stats.DialErrors),
+		Requests:   atomic.LoadInt64(&t.stats.Requests),
+		Reused:     atomic.LoadInt64(&t.stats.Reused),
+	}
+}
+
+// Remove закрывает простаивающие соединения бэкенда и забывает его транспорт
+func (p *TransportPool) Remove(u *url.URL) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := u.Scheme + "://" + u.Host
+	if t, ok := p.transports[key]; ok {
+		t.transport.CloseIdleConnections()
+		delete(p.transports, key)
+	}
+}
+
+// CloseIdleConnections закрывает простаивающие соединения всех бэкендов
+func (p *TransportPool) CloseIdleConnections() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, t := range p.transports {
+		t.transport.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,226 @@
+// Package proxyproto разбирает заголовок PROXY protocol v1 и v2, которым L4
+// балансировщик передает исходный адрес клиента.
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultHeaderTimeout — сколько ждать заголовок, если таймаут не задан
+const DefaultHeaderTimeout = 5 * time.Second
+
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// ErrInvalidHeader возвращается, если соединение не начинается с корректного заголовка
+var ErrInvalidHeader = errors.New("invalid PROXY protocol header")
+
+// Listener ожидает заголовок PROXY protocol в начале каждого соединения.
+// Trusted ограничивает, от кого заголовок принимается: соединения от
+// остальных адресов проходят как есть. nil — заголовок обязателен для всех.
+type Listener struct {
+	net.Listener
+	Trusted       func(net.IP) bool
+	HeaderTimeout time.Duration
+}
+
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if l.Trusted != nil {
+		addr, ok := conn.RemoteAddr().(*net.TCPAddr)
+		if !ok || !l.Trusted(addr.IP) {
+			return conn, nil
+		}
+	}
+
+	timeout := l.HeaderTimeout
+	if timeout <= 0 {
+		timeout = DefaultHeaderTimeout
+	}
+	return &Conn{Conn: conn, timeout: timeout}, nil
+}
+
+// Conn читает заголовок при первом обращении к Read, RemoteAddr или
+// LocalAddr, чтобы не блокировать цикл Accept медленными клиентами
+type Conn struct {
+	net.Conn
+	timeout time.Duration
+
+	once   sync.Once
+	reader *bufio.Reader
+	remote net.Addr
+	local  net.Addr
+	err    error
+}
+
+func (c *Conn) init() {
+	c.once.Do(func() {
+		c.reader = bufio.NewReader(c.Conn)
+		c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+		c.remote, c.local, c.err = readHeader(c.reader)
+		c.Conn.SetReadDeadline(time.Time{})
+		if c.err != nil {
+			log.Printf("PROXY protocol header from %s rejected: %v", c.Conn.RemoteAddr(), c.err)
+		}
+	})
+}
+
+func (c *Conn) Read(b []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+// RemoteAddr возвращает адрес клиента из заголовка. Для команды LOCAL и
+// неизвестных семейств адресов — адрес самого соединения.
+func (c *Conn) RemoteAddr() net.Addr {
+	c.init()
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *Conn) LocalAddr() net.Addr {
+	c.init()
+	if c.local != nil {
+		return c.local
+	}
+	return c.Conn.LocalAddr()
+}
+
+func readHeader(r *bufio.Reader) (src, dst net.Addr, err error) {
+	prefix, err := r.Peek(5)
+	if err != nil {
+		return nil, nil, err
+	}
+	if string(prefix) == "PROXY" {
+		return readV1(r)
+	}
+
+	signature, err := r.Peek(len(v2Signature))
+	if err != nil {
+		return nil, nil, err
+	}
+	if bytes.Equal(signature, v2Signature) {
+		return readV2(r)
+	}
+	return nil, nil, ErrInvalidHeader
+}
+
+// readV1 разбирает текстовую строку вида "PROXY TCP4 src dst sport dport\r\n"
+func readV1(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	// По спецификации строка не длиннее 107 байт
+	const maxLen = 107
+
+	var line []byte
+	for len(line) <= maxLen {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if len(line) > maxLen || !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, nil, ErrInvalidHeader
+	}
+
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) < 2 || fields[0] != "PROXY" {
+		return nil, nil, ErrInvalidHeader
+	}
+	switch fields[1] {
+	case "UNKNOWN":
+		return nil, nil, nil
+	case "TCP4", "TCP6":
+	default:
+		return nil, nil, fmt.Errorf("%w: unknown protocol %q", ErrInvalidHeader, fields[1])
+	}
+	if len(fields) != 6 {
+		return nil, nil, ErrInvalidHeader
+	}
+
+	src, err := tcpAddr(fields[2], fields[4])
+	if err != nil {
+		return nil, nil, err
+	}
+	dst, err := tcpAddr(fields[3], fields[5])
+	if err != nil {
+		return nil, nil, err
+	}
+	return src, dst, nil
+}
+
+func tcpAddr(host, port string) (*net.TCPAddr, error) {
+	ip := net.ParseIP(host)
+	p, err := strconv.ParseUint(port, 10, 16)
+	if ip == nil || err != nil {
+		return nil, fmt.Errorf("%w: bad address %s:%s", ErrInvalidHeader, host, port)
+	}
+	return &net.TCPAddr{IP: ip, Port: int(p)}, nil
+}
+
+// readV2 разбирает двоичный заголовок: сигнатура, версия и команда,
+// семейство адресов, длина и адреса. TLV-расширения пропускаются.
+func readV2(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, nil, err
+	}
+	if header[12]>>4 != 2 {
+		return nil, nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidHeader, header[12]>>4)
+	}
+	command := header[12] & 0x0f
+	family := header[13]
+
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, nil, err
+	}
+
+	switch command {
+	case 0x0: // LOCAL — соединение самого балансировщика, например проверка здоровья
+		return nil, nil, nil
+	case 0x1: // PROXY
+	default:
+		return nil, nil, fmt.Errorf("%w: unknown command %d", ErrInvalidHeader, command)
+	}
+
+	switch family >> 4 {
+	case 0x1: // AF_INET
+		if len(payload) < 12 {
+			return nil, nil, ErrInvalidHeader
+		}
+		src := &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}
+		dst := &net.TCPAddr{IP: net.IP(payload[4:8]), Port: int(binary.BigEndian.Uint16(payload[10:12]))}
+		return src, dst, nil
+	case 0x2: // AF_INET6
+		if len(payload) < 36 {
+			return nil, nil, ErrInvalidHeader
+		}
+		src := &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}
+		dst := &net.TCPAddr{IP: net.IP(payload[16:32]), Port: int(binary.BigEndian.Uint16(payload[34:36]))}
+		return src, dst, nil
+	default:
+		// AF_UNSPEC и AF_UNIX — оставляем адреса соединения
+		return nil, nil, nil
+	}
+}
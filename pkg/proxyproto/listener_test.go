@@ -0,0 +1,200 @@
+package proxyproto
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// v2 собирает двоичный заголовок с заданными версией и командой,
+// семейством адресов и содержимым
+func v2(verCmd, family byte, payload []byte) string {
+	header := append([]byte{}, v2Signature...)
+	header = append(header, verCmd, family, 0, 0)
+	binary.BigEndian.PutUint16(header[14:16], uint16(len(payload)))
+	return string(append(header, payload...))
+}
+
+func inet4Payload() []byte {
+	payload := []byte{192, 0, 2, 1, 198, 51, 100, 7, 0, 0, 0, 0}
+	binary.BigEndian.PutUint16(payload[8:10], 51000)
+	binary.BigEndian.PutUint16(payload[10:12], 443)
+	return payload
+}
+
+func inet6Payload() []byte {
+	payload := make([]byte, 36)
+	copy(payload[0:16], net.ParseIP("2001:db8::1"))
+	copy(payload[16:32], net.ParseIP("2001:db8::2"))
+	binary.BigEndian.PutUint16(payload[32:34], 40000)
+	binary.BigEndian.PutUint16(payload[34:36], 8080)
+	return payload
+}
+
+func TestReadHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		src     string
+		dst     string
+		rest    string
+		invalid bool
+		err     bool
+	}{
+		{
+			name:  "v1 tcp4",
+			input: "PROXY TCP4 192.0.2.1 198.51.100.7 51000 443\r\nGET /",
+			src:   "192.0.2.1:51000",
+			dst:   "198.51.100.7:443",
+			rest:  "GET /",
+		},
+		{
+			name:  "v1 tcp6",
+			input: "PROXY TCP6 2001:db8::1 2001:db8::2 40000 8080\r\n",
+			src:   "[2001:db8::1]:40000",
+			dst:   "[2001:db8::2]:8080",
+		},
+		{
+			name:  "v1 unknown keeps connection addresses",
+			input: "PROXY UNKNOWN\r\nbody",
+			rest:  "body",
+		},
+		{name: "v1 unknown protocol", input: "PROXY UDP4 192.0.2.1 198.51.100.7 1 2\r\n", invalid: true},
+		{name: "v1 missing fields", input: "PROXY TCP4 192.0.2.1 198.51.100.7 51000\r\n", invalid: true},
+		{name: "v1 bad address", input: "PROXY TCP4 192.0.2.x 198.51.100.7 51000 443\r\n", invalid: true},
+		{name: "v1 port out of range", input: "PROXY TCP4 192.0.2.1 198.51.100.7 70000 443\r\n", invalid: true},
+		{name: "v1 without CRLF", input: "PROXY TCP4 192.0.2.1 198.51.100.7 51000 443\n", invalid: true},
+		{name: "v1 line too long", input: "PROXY TCP4 " + strings.Repeat("1", 120) + "\r\n", invalid: true},
+		{name: "v1 truncated", input: "PROXY TCP4 192.0.2.1", err: true},
+		{
+			name:  "v2 inet",
+			input: v2(0x21, 0x11, inet4Payload()) + "GET /",
+			src:   "192.0.2.1:51000",
+			dst:   "198.51.100.7:443",
+			rest:  "GET /",
+		},
+		{
+			name:  "v2 inet6",
+			input: v2(0x21, 0x21, inet6Payload()),
+			src:   "[2001:db8::1]:40000",
+			dst:   "[2001:db8::2]:8080",
+		},
+		{
+			name:  "v2 skips TLV",
+			input: v2(0x21, 0x11, append(inet4Payload(), 0x04, 0x00, 0x01, 0xff)) + "x",
+			src:   "192.0.2.1:51000",
+			dst:   "198.51.100.7:443",
+			rest:  "x",
+		},
+		{name: "v2 local", input: v2(0x20, 0x00, nil) + "x", rest: "x"},
+		{name: "v2 unix keeps connection addresses", input: v2(0x21, 0x31, make([]byte, 216))},
+		{name: "v2 wrong version", input: v2(0x11, 0x11, inet4Payload()), invalid: true},
+		{name: "v2 unknown command", input: v2(0x22, 0x11, inet4Payload()), invalid: true},
+		{name: "v2 short inet payload", input: v2(0x21, 0x11, make([]byte, 8)), invalid: true},
+		{name: "v2 short inet6 payload", input: v2(0x21, 0x21, make([]byte, 12)), invalid: true},
+		{name: "v2 truncated payload", input: v2(0x21, 0x11, inet4Payload())[:20], err: true},
+		{name: "no header", input: "GET / HTTP/1.1\r\n\r\n", invalid: true},
+		{name: "empty", input: "", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bufio.NewReader(strings.NewReader(tt.input))
+			src, dst, err := readHeader(r)
+			switch {
+			case tt.invalid:
+				if !errors.Is(err, ErrInvalidHeader) {
+					t.Fatalf("err = %v, want ErrInvalidHeader", err)
+				}
+				return
+			case tt.err:
+				if err == nil {
+					t.Fatalf("err = nil, want error")
+				}
+				return
+			case err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := addrString(src); got != tt.src {
+				t.Errorf("src = %q, want %q", got, tt.src)
+			}
+			if got := addrString(dst); got != tt.dst {
+				t.Errorf("dst = %q, want %q", got, tt.dst)
+			}
+			rest, _ := io.ReadAll(r)
+			if string(rest) != tt.rest {
+				t.Errorf("rest = %q, want %q", rest, tt.rest)
+			}
+		})
+	}
+}
+
+func addrString(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	return addr.String()
+}
+
+func TestConn(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		remote string
+		body   string
+		err    bool
+	}{
+		{
+			name:   "address from header",
+			input:  "PROXY TCP4 192.0.2.1 198.51.100.7 51000 443\r\nping",
+			remote: "192.0.2.1:51000",
+			body:   "ping",
+		},
+		{
+			name:   "local command keeps peer address",
+			input:  v2(0x20, 0x00, nil) + "ping",
+			remote: "pipe",
+			body:   "ping",
+		},
+		{
+			name:   "rejected header",
+			input:  "GET / HTTP/1.1\r\n\r\n",
+			remote: "pipe",
+			err:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer server.Close()
+			go func() {
+				io.WriteString(client, tt.input)
+				client.Close()
+			}()
+
+			conn := &Conn{Conn: server, timeout: DefaultHeaderTimeout}
+			if got := conn.RemoteAddr().String(); got != tt.remote {
+				t.Errorf("RemoteAddr = %q, want %q", got, tt.remote)
+			}
+			body, err := io.ReadAll(conn)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("Read err = nil, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Read: %v", err)
+			}
+			if string(body) != tt.body {
+				t.Errorf("body = %q, want %q", body, tt.body)
+			}
+		})
+	}
+}
@@ -0,0 +1,267 @@
+// Package resp — минимальный клиент протокола Redis (RESP2) с пулом
+// соединений и конвейерной отправкой команд.
+package resp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error — ответ сервера с ошибкой ("-ERR ...")
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// ErrClosed возвращается после Close
+var ErrClosed = errors.New("resp: client closed")
+
+// Options — параметры подключения. Password и DB отправляются командами
+// AUTH и SELECT при открытии каждого соединения.
+type Options struct {
+	Addr        string
+	Password    string
+	DB          int
+	PoolSize    int
+	DialTimeout time.Duration
+}
+
+// Client держит не больше PoolSize соединений. Соединение, на котором
+// произошла ошибка ввода-вывода, закрывается и не возвращается в пул.
+type Client struct {
+	opts   Options
+	slots  chan struct{}
+	idle   chan *conn
+	closed chan struct{}
+}
+
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+func NewClient(opts Options) *Client {
+	if opts.PoolSize <= 0 {
+		opts.PoolSize = 16
+	}
+	if opts.DialTimeout <= 0 {
+		opts.DialTimeout = time.Second
+	}
+	return &Client{
+		opts:   opts,
+		slots:  make(chan struct{}, opts.PoolSize),
+		idle:   make(chan *conn, opts.PoolSize),
+		closed: make(chan struct{}),
+	}
+}
+
+// Do выполняет одну команду
+func (c *Client) Do(ctx context.Context, args ...string) (interface{}, error) {
+	replies, err := c.Pipeline(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	if e, ok := replies[0].(Error); ok {
+		return nil, e
+	}
+	return replies[0], nil
+}
+
+// Pipeline отправляет команды одним пакетом и читает ответы по порядку.
+// Ответы: int64, string, nil (пустой bulk), []interface{} или Error.
+func (c *Client) Pipeline(ctx context.Context, cmds ...[]string) ([]interface{}, error) {
+	cn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Time{}
+	}
+	cn.SetDeadline(deadline)
+
+	replies, err := roundTrip(cn, cmds)
+	if err != nil {
+		cn.Close()
+		<-c.slots
+		return nil, err
+	}
+	c.put(cn)
+	return replies, nil
+}
+
+// Close закрывает простаивающие соединения; занятые закрываются при возврате
+func (c *Client) Close() error {
+	select {
+	case <-c.closed:
+		return nil
+	default:
+		close(c.closed)
+	}
+	for {
+		select {
+		case cn := <-c.idle:
+			cn.Close()
+			<-c.slots
+		default:
+			return nil
+		}
+	}
+}
+
+func (c *Client) get(ctx context.Context) (*conn, error) {
+	select {
+	case <-c.closed:
+		return nil, ErrClosed
+	case cn := <-c.idle:
+		return cn, nil
+	default:
+	}
+
+	select {
+	case <-c.closed:
+		return nil, ErrClosed
+	case cn := <-c.idle:
+		return cn, nil
+	case c.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	cn, err := c.dial(ctx)
+	if err != nil {
+		<-c.slots
+		return nil, err
+	}
+	return cn, nil
+}
+
+func (c *Client) put(cn *conn) {
+	select {
+	case <-c.closed:
+		cn.Close()
+		<-c.slots
+		return
+	default:
+	}
+	// В idle помещаются все соединения пула, поэтому запись не блокируется
+	c.idle <- cn
+}
+
+func (c *Client) dial(ctx context.Context) (*conn, error) {
+	dialer := net.Dialer{Timeout: c.opts.DialTimeout}
+	nc, err := dialer.DialContext(ctx, "tcp", c.opts.Addr)
+	if err != nil {
+		return nil, err
+	}
+	cn := &conn{Conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+
+	var setup [][]string
+	if c.opts.Password != "" {
+		setup = append(setup, []string{"AUTH", c.opts.Password})
+	}
+	if c.opts.DB != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(c.opts.DB)})
+	}
+	if len(setup) > 0 {
+		if deadline, ok := ctx.Deadline(); ok {
+			nc.SetDeadline(deadline)
+		}
+		replies, err := roundTrip(cn, setup)
+		if err == nil {
+			for _, reply := range replies {
+				if e, ok := reply.(Error); ok {
+					err = e
+					break
+				}
+			}
+		}
+		if err != nil {
+			nc.Close()
+			return nil, err
+		}
+	}
+	return cn, nil
+}
+
+func roundTrip(cn *conn, cmds [][]string) ([]interface{}, error) {
+	for _, args := range cmds {
+		fmt.Fprintf(cn.w, "*%d\r\n", len(args))
+		for _, arg := range args {
+			fmt.Fprintf(cn.w, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+	}
+	if err := cn.w.Flush(); err != nil {
+		return nil, err
+	}
+
+	replies := make([]interface{}, len(cmds))
+	for i := range cmds {
+		reply, err := readReply(cn.r)
+		if err != nil {
+			return nil, err
+		}
+		replies[i] = reply
+	}
+	return replies, nil
+}
+
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, fmt.Errorf("resp: malformed reply %q", line)
+	}
+	kind, payload := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return payload, nil
+	case '-':
+		return Error(payload), nil
+	case ':':
+		return strconv.ParseInt(payload, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("resp: unknown reply type %q", kind)
+	}
+}
@@ -0,0 +1,190 @@
+package resp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadReply(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  interface{}
+		err   bool
+	}{
+		{name: "simple string", input: "+OK\r\n", want: "OK"},
+		{name: "error", input: "-ERR wrong type\r\n", want: Error("ERR wrong type")},
+		{name: "integer", input: ":42\r\n", want: int64(42)},
+		{name: "negative integer", input: ":-2\r\n", want: int64(-2)},
+		{name: "bulk string", input: "$5\r\nhello\r\n", want: "hello"},
+		{name: "bulk with CRLF inside", input: "$4\r\na\r\nb\r\n", want: "a\r\nb"},
+		{name: "empty bulk", input: "$0\r\n\r\n", want: ""},
+		{name: "null bulk", input: "$-1\r\n", want: nil},
+		{name: "null array", input: "*-1\r\n", want: nil},
+		{name: "empty array", input: "*0\r\n", want: []interface{}{}},
+		{
+			name:  "nested array",
+			input: "*3\r\n:1\r\n$3\r\nfoo\r\n*1\r\n+bar\r\n",
+			want:  []interface{}{int64(1), "foo", []interface{}{"bar"}},
+		},
+		{name: "unknown type", input: "!3\r\n", err: true},
+		{name: "missing CR", input: "+OK\n", err: true},
+		{name: "too short", input: "\r\n", err: true},
+		{name: "bad integer", input: ":abc\r\n", err: true},
+		{name: "bad bulk length", input: "$x\r\n", err: true},
+		{name: "truncated bulk", input: "$5\r\nhel", err: true},
+		{name: "truncated array", input: "*2\r\n:1\r\n", err: true},
+		{name: "eof", input: "", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readReply(bufio.NewReader(strings.NewReader(tt.input)))
+			if tt.err {
+				if err == nil {
+					t.Fatalf("err = nil, want error (reply %#v)", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("reply = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeServer принимает одно соединение, отвечает на каждую команду
+// следующим ответом из replies и отдает принятые байты в received
+func fakeServer(t *testing.T, replies []string) (addr string, received <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	out := make(chan string, 1)
+	go func() {
+		var raw strings.Builder
+		defer func() { out <- raw.String() }()
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(io.TeeReader(conn, &raw))
+		for _, reply := range replies {
+			if _, err := readReply(r); err != nil {
+				return
+			}
+			io.WriteString(conn, reply)
+		}
+	}()
+	return ln.Addr().String(), out
+}
+
+func TestClientPipeline(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		cmds    [][]string
+		replies []string
+		want    []interface{}
+		sent    string
+	}{
+		{
+			name:    "single command",
+			cmds:    [][]string{{"GET", "key"}},
+			replies: []string{"$5\r\nvalue\r\n"},
+			want:    []interface{}{"value"},
+			sent:    "*2\r\n$3\r\nGET\r\n$3\r\nkey\r\n",
+		},
+		{
+			name:    "pipeline keeps order and server errors",
+			cmds:    [][]string{{"INCRBY", "k", "3"}, {"PEXPIRE", "k", "1000"}, {"HGET", "k", "f"}},
+			replies: []string{":3\r\n", "-ERR wrong type\r\n", "$-1\r\n"},
+			want:    []interface{}{int64(3), Error("ERR wrong type"), nil},
+			sent: "*3\r\n$6\r\nINCRBY\r\n$1\r\nk\r\n$1\r\n3\r\n" +
+				"*3\r\n$7\r\nPEXPIRE\r\n$1\r\nk\r\n$4\r\n1000\r\n" +
+				"*3\r\n$4\r\nHGET\r\n$1\r\nk\r\n$1\r\nf\r\n",
+		},
+		{
+			name:    "auth and select on connect",
+			opts:    Options{Password: "secret", DB: 2},
+			cmds:    [][]string{{"PING"}},
+			replies: []string{"+OK\r\n", "+OK\r\n", "+PONG\r\n"},
+			want:    []interface{}{"PONG"},
+			sent: "*2\r\n$4\r\nAUTH\r\n$6\r\nsecret\r\n" +
+				"*2\r\n$6\r\nSELECT\r\n$1\r\n2\r\n" +
+				"*1\r\n$4\r\nPING\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, received := fakeServer(t, tt.replies)
+			tt.opts.Addr = addr
+			client := NewClient(tt.opts)
+
+			got, err := client.Pipeline(context.Background(), tt.cmds...)
+			if err != nil {
+				t.Fatalf("Pipeline: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("replies = %#v, want %#v", got, tt.want)
+			}
+			client.Close()
+			if sent := <-received; sent != tt.sent {
+				t.Errorf("sent %q, want %q", sent, tt.sent)
+			}
+		})
+	}
+}
+
+func TestClientDo(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  Options
+		reply []string
+		want  interface{}
+		err   error
+	}{
+		{name: "value", reply: []string{":7\r\n"}, want: int64(7)},
+		{name: "server error", reply: []string{"-ERR unknown command\r\n"}, err: Error("ERR unknown command")},
+		{name: "auth rejected", opts: Options{Password: "bad"}, reply: []string{"-WRONGPASS invalid password\r\n"}, err: Error("WRONGPASS invalid password")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, _ := fakeServer(t, tt.reply)
+			tt.opts.Addr = addr
+			client := NewClient(tt.opts)
+			defer client.Close()
+
+			got, err := client.Do(context.Background(), "GET", "k")
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("reply = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientClosed(t *testing.T) {
+	client := NewClient(Options{Addr: "127.0.0.1:1"})
+	client.Close()
+	if _, err := client.Do(context.Background(), "PING"); !errors.Is(err, ErrClosed) {
+		t.Fatalf("err = %v, want ErrClosed", err)
+	}
+}